@@ -12,10 +12,10 @@ type CommandEngine struct {
 }
 
 func NewCommandEngine() *CommandEngine {
-	var rootCmd = &cobra.Command {
-		Use: "tendo",
+	var rootCmd = &cobra.Command{
+		Use:   "tendo",
 		Short: "tendo CLI",
-		Long: "tendo service command line",
+		Long:  "tendo service command line",
 	}
 
 	return &CommandEngine{
@@ -28,15 +28,39 @@ func (c *CommandEngine) Run() {
 
 	var kubeconfig string
 
-	var commands = []*cobra.Command {
+	var commands = []*cobra.Command{
 		{
-			Use: "server",
+			Use:   "server",
 			Short: "tendo start HTTP server",
-			Long: "command to start HTTP server of tendo service",
+			Long:  "command to start HTTP server of tendo service",
 			Run: func(cmd *cobra.Command, args []string) {
 				kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
-				
-				ServerListen(kubeconfig)
+				dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+				ServerListen(kubeconfig, dryRun)
+			},
+		},
+		{
+			Use:   "fake-tencent",
+			Short: "tendo start local Tencent SSL API stand-in",
+			Long:  "command to serve a local in-memory stand-in of the Tencent Cloud SSL API for integration testing",
+			Run: func(cmd *cobra.Command, args []string) {
+				address, _ := cmd.Flags().GetString("listen")
+				secretID, _ := cmd.Flags().GetString("secret-id")
+				secretKey, _ := cmd.Flags().GetString("secret-key")
+
+				FakeTencentListen(address, secretID, secretKey)
+			},
+		},
+		{
+			Use:   "orphans",
+			Short: "tendo list orphaned certificates",
+			Long:  "command to list duplicate, superseded and unbound certificates tendo left in Tencent Cloud, and delete them with --delete",
+			Run: func(cmd *cobra.Command, args []string) {
+				kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+				remove, _ := cmd.Flags().GetBool("delete")
+
+				ListOrphans(kubeconfig, remove)
 			},
 		},
 	}
@@ -46,6 +70,17 @@ func (c *CommandEngine) Run() {
 
 		if command.Name() == "server" {
 			c.rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "add kubeconfig file path")
+			command.Flags().Bool("dry-run", false, "log and report the changes of every target without making them")
+		}
+
+		if command.Name() == "fake-tencent" {
+			command.Flags().String("listen", "127.0.0.1:9000", "address the stand-in listens on")
+			command.Flags().String("secret-id", "", "secret id accepted by the stand-in, signatures are not verified when empty")
+			command.Flags().String("secret-key", "", "secret key used to verify request signatures")
+		}
+
+		if command.Name() == "orphans" {
+			command.Flags().Bool("delete", false, "delete the listed certificates")
 		}
 	}
 
@@ -53,4 +88,4 @@ func (c *CommandEngine) Run() {
 		msg := fmt.Sprintf("failed to execute command with error: %s", err)
 		logger.Logger.Error(msg)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+)
+
+func FakeTencentListen(address string, secretID string, secretKey string) {
+	ssl := fake.NewSSLClient()
+
+	// step deploy records through pending and deploying before success,
+	// so the watcher has to poll like it does against tencent cloud
+	ssl.SetDeploySteps(fake.DeployStatusPending, fake.DeployStatusDeploying, fake.DeployStatusSuccess)
+
+	// listeners are created on first use, there is no API to create them
+	clb := fake.NewCLBClient(ssl)
+	clb.AutoCreate = true
+
+	server := fake.NewServer(ssl)
+	server.ServeCLB(clb)
+	if secretID != "" {
+		server.Credentials[secretID] = secretKey
+	}
+
+	logger.Logger.Info(fmt.Sprintf("Tencent SSL and CLB API stand-in is running and listening on %s", address))
+
+	err := http.ListenAndServe(address, server)
+	logger.Logger.Fatal(fmt.Sprintf("Received unrecovered errors, %s", err))
+}
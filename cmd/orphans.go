@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/watcher"
+)
+
+// ListOrphans prints the orphaned certificates of every account, and deletes
+// them when remove is set.
+func ListOrphans(kubeconfig string, remove bool) {
+	cfg := config.LoadConfig()
+
+	ctx := context.Background()
+
+	if err := audit.Open(cfg.Audit.Output); err != nil {
+		logger.Logger.Fatal(err.Error())
+	}
+	defer audit.Close()
+
+	accounts, err := watcher.ScanOrphans(ctx, &cfg, kubeconfig)
+	if err != nil {
+		logger.Logger.Error(fmt.Sprintf("unable to scan some accounts for orphaned certificates with error: %s", err))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tCERTIFICATE ID\tALIAS\tDOMAIN\tEXPIRES\tREASON\tOWNER")
+
+	total := 0
+	for _, account := range accounts {
+		for _, orphan := range account.Orphans {
+			expires := "-"
+			if !orphan.ExpiresAt.IsZero() {
+				expires = orphan.ExpiresAt.Format(time.RFC3339)
+			}
+
+			owner := orphan.Owner
+			if owner == "" {
+				owner = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", account.Account, orphan.CertificateID, orphan.Alias, orphan.Domain, expires, orphan.Reason, owner)
+			total++
+		}
+	}
+	w.Flush()
+
+	if !remove || total == 0 {
+		return
+	}
+
+	err = watcher.DeleteOrphans(ctx, &cfg, kubeconfig, accounts)
+	if err != nil {
+		logger.Logger.Fatal(fmt.Sprintf("unable to delete orphaned certificates with error: %s", err))
+	}
+}
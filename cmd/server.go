@@ -9,19 +9,32 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
 	"github.com/fredytarigan/Tendo/pkg/tendo/config"
 	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/metrics"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
 	"github.com/fredytarigan/Tendo/pkg/tendo/watcher"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
-func ServerListen(kubeconfig string) {
+func ServerListen(kubeconfig string, dryRun bool) {
 	cfg := config.LoadConfig()
 
+	// the flag turns dry run on for every target, it never turns it off
+	if dryRun {
+		cfg.DryRun = true
+	}
+
 	ctx := context.Background()
 
-	handler := mux.NewRouter();
+	if err := audit.Open(cfg.Audit.Output); err != nil {
+		logger.Logger.Fatal(err.Error())
+	}
+	defer audit.Close()
+
+	handler := mux.NewRouter()
 
 	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		logger.Logger.Info(
@@ -34,7 +47,6 @@ func ServerListen(kubeconfig string) {
 	initServeHttp(handler)
 	errs := make(chan error)
 
-
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -47,10 +59,10 @@ func ServerListen(kubeconfig string) {
 		logger.Logger.Info(fmt.Sprintf("Server is running and listening on %s", address))
 
 		srvHttp := &http.Server{
-			ReadTimeout: 5 * time.Second,
+			ReadTimeout:  5 * time.Second,
 			WriteTimeout: 5 * time.Second,
-			Addr: address,
-			Handler: handler,
+			Addr:         address,
+			Handler:      handler,
 		}
 
 		errs <- srvHttp.ListenAndServe()
@@ -77,4 +89,7 @@ func initServeHttp(handler *mux.Router) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Server is ready and healthy")
 	})
-}
\ No newline at end of file
+
+	handler.Handle("/metrics", metrics.Handler())
+	handler.Handle("/status", status.Handler())
+}
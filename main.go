@@ -7,13 +7,15 @@ import (
 )
 
 func init() {
+	logger.Init()
+
 	logger.Logger.Info("Starting application service")
 	logger.Logger.Info("Initializing application config")
-	
+
 	config.SetConfigFile("./config")
 }
 
 func main() {
-	command := cmd.NewCommandEngine();
-	command.Run();
-}
\ No newline at end of file
+	command := cmd.NewCommandEngine()
+	command.Run()
+}
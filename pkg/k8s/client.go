@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
 	"k8s.io/client-go/kubernetes"
@@ -9,6 +10,24 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// ClusterConfig describes how to reach one kubernetes cluster. An empty
+// Kubeconfig and Context falls back to the in-cluster config.
+type ClusterConfig struct {
+	Name       string
+	Kubeconfig string
+	Context    string
+	InCluster  bool
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]kubernetes.Interface{}
+)
+
+// ClusterClientFactory, when set, replaces the client built by
+// GetClusterClient, e.g. with a fake clientset in tests.
+var ClusterClientFactory func(cluster ClusterConfig) (kubernetes.Interface, error)
+
 func BuildConfig(kubeconfig string) (*rest.Config, error) {
 	if kubeconfig != "" {
 		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -27,6 +46,28 @@ func BuildConfig(kubeconfig string) (*rest.Config, error) {
 	return cfg, nil
 }
 
+func BuildClusterConfig(cluster ClusterConfig) (*rest.Config, error) {
+	if cluster.InCluster || (cluster.Kubeconfig == "" && cluster.Context == "") {
+		return BuildConfig("")
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cluster.Kubeconfig != "" {
+		loadingRules.ExplicitPath = cluster.Kubeconfig
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: cluster.Context,
+	}
+
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
 func GetKubernetesConfig(kubeconfig string) kubernetes.Clientset {
 	config, err := BuildConfig(kubeconfig)
 	if err != nil {
@@ -39,4 +80,35 @@ func GetKubernetesConfig(kubeconfig string) kubernetes.Clientset {
 	}
 
 	return *clientSet
-}
\ No newline at end of file
+}
+
+// GetClusterClient returns a client for the given cluster, building it on
+// first use and reusing it afterwards.
+func GetClusterClient(cluster ClusterConfig) (kubernetes.Interface, error) {
+	if ClusterClientFactory != nil {
+		return ClusterClientFactory(cluster)
+	}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if clientSet, ok := clients[cluster.Name]; ok {
+		return clientSet, nil
+	}
+
+	config, err := BuildClusterConfig(cluster)
+	if err != nil {
+		err := fmt.Errorf("unable to build kubernetes client config for cluster %s with error: %s", cluster.Name, err)
+		return nil, err
+	}
+
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		err := fmt.Errorf("unable to setup kubernetes client for cluster %s with error: %s", cluster.Name, err)
+		return nil, err
+	}
+
+	clients[cluster.Name] = clientSet
+
+	return clientSet, nil
+}
@@ -0,0 +1,78 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: primary
+  cluster:
+    server: https://primary.example.com:6443
+- name: edge
+  cluster:
+    server: https://edge.example.com:6443
+users:
+- name: tendo
+  user:
+    token: tendo-token
+contexts:
+- name: primary
+  context:
+    cluster: primary
+    user: tendo
+- name: edge
+  context:
+    cluster: edge
+    user: tendo
+current-context: primary
+`
+
+func TestBuildClusterConfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+
+	err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cluster ClusterConfig
+		host    string
+	}{
+		{
+			name:    "current context",
+			cluster: ClusterConfig{Name: "primary", Kubeconfig: kubeconfig},
+			host:    "https://primary.example.com:6443",
+		},
+		{
+			name:    "named context",
+			cluster: ClusterConfig{Name: "edge", Kubeconfig: kubeconfig, Context: "edge"},
+			host:    "https://edge.example.com:6443",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := BuildClusterConfig(test.cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Host != test.host {
+				t.Errorf("got host %s, want %s", cfg.Host, test.host)
+			}
+		})
+	}
+
+	t.Run("unknown context", func(t *testing.T) {
+		_, err := BuildClusterConfig(ClusterConfig{Name: "staging", Kubeconfig: kubeconfig, Context: "staging"})
+		if err == nil {
+			t.Error("got no error")
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package tencent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+)
+
+const defaultOIDCDurationSeconds = 7200
+
+// Account is a named set of Tencent Cloud credentials. Exactly one source is
+// used: static SecretID and SecretKey, e.g. read from a Kubernetes secret,
+// an EnvPrefix or a TKE OIDC role.
+type Account struct {
+	Name      string
+	SecretID  string
+	SecretKey string
+	Token     string
+	EnvPrefix string
+	OIDC      *OIDCRole
+}
+
+// OIDCRole assumes a CAM role with the web identity token of a TKE service
+// account. Empty fields fall back to the TKE_* variables TKE injects.
+type OIDCRole struct {
+	Region          string
+	ProviderID      string
+	RoleArn         string
+	TokenFile       string
+	SessionName     string
+	DurationSeconds int64
+}
+
+// BuildAccountCredentials builds the credentials of a named account.
+func BuildAccountCredentials(account Account) (common.CredentialIface, error) {
+	switch {
+	case account.SecretID != "":
+		if account.SecretKey == "" {
+			err := fmt.Errorf("secret key of account %s is empty", account.Name)
+			return nil, err
+		}
+
+		if account.Token != "" {
+			return common.NewTokenCredential(account.SecretID, account.SecretKey, account.Token), nil
+		}
+
+		return common.NewCredential(account.SecretID, account.SecretKey), nil
+
+	case account.EnvPrefix != "":
+		// e.g. TENCENTCLOUD_PROD reads TENCENTCLOUD_PROD_SECRET_ID
+		prefix := strings.TrimSuffix(account.EnvPrefix, "_")
+
+		secretID := os.Getenv(prefix + "_SECRET_ID")
+		secretKey := os.Getenv(prefix + "_SECRET_KEY")
+		if secretID == "" || secretKey == "" {
+			err := fmt.Errorf("%s_SECRET_ID and %s_SECRET_KEY must be set for account %s", prefix, prefix, account.Name)
+			return nil, err
+		}
+
+		if token := os.Getenv(prefix + "_TOKEN"); token != "" {
+			return common.NewTokenCredential(secretID, secretKey, token), nil
+		}
+
+		return common.NewCredential(secretID, secretKey), nil
+
+	case account.OIDC != nil:
+		return buildOIDCCredentials(account.Name, *account.OIDC)
+	}
+
+	err := fmt.Errorf("account %s has no credentials source", account.Name)
+	return nil, err
+}
+
+func buildOIDCCredentials(name string, role OIDCRole) (common.CredentialIface, error) {
+	region := valueOrEnv(role.Region, "TKE_REGION")
+	providerID := valueOrEnv(role.ProviderID, "TKE_PROVIDER_ID")
+	roleArn := valueOrEnv(role.RoleArn, "TKE_ROLE_ARN")
+	tokenFile := valueOrEnv(role.TokenFile, "TKE_WEB_IDENTITY_TOKEN_FILE")
+
+	if region == "" || providerID == "" || roleArn == "" || tokenFile == "" {
+		err := fmt.Errorf("oidc role of account %s needs region, provider id, role arn and token file", name)
+		return nil, err
+	}
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		err := fmt.Errorf("unable to read web identity token of account %s with error: %s", name, err)
+		return nil, err
+	}
+
+	sessionName := role.SessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("tendo-%s", name)
+	}
+
+	durationSeconds := role.DurationSeconds
+	if durationSeconds <= 0 {
+		durationSeconds = defaultOIDCDurationSeconds
+	}
+
+	provider := common.NewOIDCRoleArnProvider(region, providerID, strings.TrimSpace(string(token)), roleArn, sessionName, durationSeconds)
+
+	creds, err := provider.GetCredential()
+	if err != nil {
+		err := fmt.Errorf("unable to assume oidc role of account %s with error: %s", name, err)
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+func valueOrEnv(value string, env string) string {
+	if value != "" {
+		return value
+	}
+
+	return os.Getenv(env)
+}
@@ -0,0 +1,75 @@
+package tencent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+)
+
+// sdkResponse is implemented by every Tencent Cloud SDK response.
+type sdkResponse interface {
+	ToJsonString() string
+}
+
+// audit records a mutating call made for the target on the audit log, with
+// the request id of its response, or of its error when it failed.
+func (t *TencentSSLCertificate) audit(event audit.Event, response sdkResponse, err error) {
+	event.Account = t.Account
+	event.Target = t.Target
+	event.Result = audit.ResultSuccess
+
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Error = err.Error()
+
+		var sdkError *tencentCloudSDKError.TencentCloudSDKError
+		if errors.As(err, &sdkError) {
+			event.RequestID = sdkError.GetRequestId()
+		}
+	} else if response != nil {
+		event.RequestID = responseRequestID(response)
+	}
+
+	audit.Record(event)
+}
+
+func responseRequestID(response sdkResponse) string {
+	var body struct {
+		Response struct {
+			RequestID string `json:"RequestId"`
+		} `json:"Response"`
+	}
+
+	err := json.Unmarshal([]byte(response.ToJsonString()), &body)
+	if err != nil {
+		return ""
+	}
+
+	return body.Response.RequestID
+}
+
+// auditDeployment records the certificate an UpdateCertificateInstance call
+// uploaded, which is only known from the deploy records once they finished.
+func (t *TencentSSLCertificate) auditDeployment(summary DeploymentSummary) {
+	for _, record := range summary.Succeeded {
+		t.audit(deploymentEvent(record), nil, nil)
+	}
+
+	for _, record := range summary.Failed {
+		err := fmt.Errorf("deploy record %d %s", record.ID, record.Status)
+		t.audit(deploymentEvent(record), nil, err)
+	}
+}
+
+func deploymentEvent(record CertificateDeployRecord) audit.Event {
+	return audit.Event{
+		Action:           "DeployCertificateUpdate",
+		CertificateID:    record.CertID,
+		OldCertificateID: record.OldCertID,
+		Resources:        record.ResourceTypes,
+	}
+}
@@ -0,0 +1,265 @@
+package tencent
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/clb/v20180317"
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+// mutatingCall is a mutating call received by the recording clients and the
+// request id it was answered with.
+type mutatingCall struct {
+	action    string
+	requestID string
+	failed    bool
+}
+
+type callRecorder struct {
+	calls []mutatingCall
+}
+
+func (r *callRecorder) record(action string, response sdkResponse, err error) {
+	call := mutatingCall{action: action, failed: err != nil}
+
+	var sdkError *tencentCloudSDKError.TencentCloudSDKError
+	if errors.As(err, &sdkError) {
+		call.requestID = sdkError.GetRequestId()
+	} else if err == nil {
+		call.requestID = responseRequestID(response)
+	}
+
+	r.calls = append(r.calls, call)
+}
+
+// recordingSSLClient records the mutating calls made to the fake.
+type recordingSSLClient struct {
+	*fake.SSLClient
+	*callRecorder
+}
+
+func (c recordingSSLClient) UploadCertificateWithContext(ctx context.Context, request *sslCertificate.UploadCertificateRequest) (*sslCertificate.UploadCertificateResponse, error) {
+	response, err := c.SSLClient.UploadCertificateWithContext(ctx, request)
+	c.record("UploadCertificate", response, err)
+	return response, err
+}
+
+func (c recordingSSLClient) UpdateCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.UpdateCertificateInstanceRequest) (*sslCertificate.UpdateCertificateInstanceResponse, error) {
+	response, err := c.SSLClient.UpdateCertificateInstanceWithContext(ctx, request)
+	c.record("UpdateCertificateInstance", response, err)
+	return response, err
+}
+
+func (c recordingSSLClient) DeleteCertificateWithContext(ctx context.Context, request *sslCertificate.DeleteCertificateRequest) (*sslCertificate.DeleteCertificateResponse, error) {
+	response, err := c.SSLClient.DeleteCertificateWithContext(ctx, request)
+	c.record("DeleteCertificate", response, err)
+	return response, err
+}
+
+func (c recordingSSLClient) ModifyCertificateAliasWithContext(ctx context.Context, request *sslCertificate.ModifyCertificateAliasRequest) (*sslCertificate.ModifyCertificateAliasResponse, error) {
+	response, err := c.SSLClient.ModifyCertificateAliasWithContext(ctx, request)
+	c.record("ModifyCertificateAlias", response, err)
+	return response, err
+}
+
+func (c recordingSSLClient) DeployCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.DeployCertificateInstanceRequest) (*sslCertificate.DeployCertificateInstanceResponse, error) {
+	response, err := c.SSLClient.DeployCertificateInstanceWithContext(ctx, request)
+	c.record("DeployCertificateInstance", response, err)
+	return response, err
+}
+
+// recordingCLBClient records the mutating calls made to the fake.
+type recordingCLBClient struct {
+	*fake.CLBClient
+	*callRecorder
+}
+
+func (c recordingCLBClient) ModifyListenerWithContext(ctx context.Context, request *clb.ModifyListenerRequest) (*clb.ModifyListenerResponse, error) {
+	response, err := c.CLBClient.ModifyListenerWithContext(ctx, request)
+	c.record("ModifyListener", response, err)
+	return response, err
+}
+
+func (c recordingCLBClient) ModifyDomainAttributesWithContext(ctx context.Context, request *clb.ModifyDomainAttributesRequest) (*clb.ModifyDomainAttributesResponse, error) {
+	response, err := c.CLBClient.ModifyDomainAttributesWithContext(ctx, request)
+	c.record("ModifyDomainAttributes", response, err)
+	return response, err
+}
+
+// testAudit writes the audit log to a file for the duration of the test and
+// returns a function reading its events.
+func testAudit(t *testing.T) func() []audit.Event {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := audit.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		audit.Close()
+	})
+
+	return func() []audit.Event {
+		t.Helper()
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		var events []audit.Event
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event audit.Event
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				t.Fatalf("invalid audit event %s with error: %s", scanner.Text(), err)
+			}
+
+			events = append(events, event)
+		}
+
+		return events
+	}
+}
+
+func TestAudit(t *testing.T) {
+	fastPolling(t)
+
+	policy := DefaultRetryPolicy
+	DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	t.Cleanup(func() {
+		DefaultRetryPolicy = policy
+	})
+
+	events := testAudit(t)
+
+	recorder := &callRecorder{}
+	ssl := fake.NewSSLClient()
+	client := recordingSSLClient{SSLClient: ssl, callRecorder: recorder}
+	clbClient := recordingCLBClient{CLBClient: fake.NewCLBClient(ssl), callRecorder: recorder}
+
+	target := testTarget(t, "app", "app.example.com")
+	target.Account = "test"
+	target.CertificateResourceTypes = []CertificateResourceType{{Name: "cdn"}}
+
+	caPEM, _ := testCertificate(t, "Tendo Test CA")
+	target.CACertificate = base64.StdEncoding.EncodeToString([]byte(caPEM))
+
+	// every mutating call tendo makes, including a retried and a failed one
+	certID, err := target.CreateCertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.CertificateID = certID
+
+	if err := target.UpdateCertificateDetail(client); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := target.ModifyCertificateName(client, certID, "app-v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ssl.InjectError("UploadCertificate", "RequestLimitExceeded", "too many requests", 1)
+
+	caCertID, err := target.CreateCACertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCertID, err := target.CreateCertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ssl.BindInstance("cdn", "cdn-1", certID)
+
+	_, err = target.DeployCertificateInstance(client, newCertID, certID, CertificateInstance{ResourceType: "cdn", InstanceIDs: []string{"cdn-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clbClient.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: certID})
+
+	if err := target.BindCLBListener(clbClient, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := target.DeleteCertificate(client, "missing"); err == nil {
+		t.Fatal("got no error deleting a missing certificate")
+	}
+
+	if _, err := target.DeleteCertificate(client, certID); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := events()
+
+	if len(recorded) != len(recorder.calls) {
+		t.Fatalf("got %d audit events for %d mutating calls", len(recorded), len(recorder.calls))
+	}
+
+	for i, call := range recorder.calls {
+		event := recorded[i]
+
+		if event.Action != call.action || event.RequestID != call.requestID {
+			t.Errorf("call %d: got %s event with request id %q, want %s with %q", i, event.Action, event.RequestID, call.action, call.requestID)
+		}
+
+		if call.requestID == "" {
+			t.Errorf("call %d: %s was answered without a request id", i, call.action)
+		}
+
+		result := audit.ResultSuccess
+		if call.failed {
+			result = audit.ResultFailure
+		}
+
+		if event.Result != result || (call.failed && event.Error == "") {
+			t.Errorf("call %d: got %s event with result %s and error %q, want %s", i, event.Action, event.Result, event.Error, result)
+		}
+
+		if event.Log != audit.Log || event.Account != "test" || event.Target != "default/tendo/app" || event.Time.IsZero() {
+			t.Errorf("call %d: got %+v, want the log, account, target and time filled in", i, event)
+		}
+	}
+
+	t.Run("retried call is audited once per attempt", func(t *testing.T) {
+		var uploads []audit.Event
+		for _, event := range recorded {
+			if event.Action == "UploadCertificate" && event.Alias == "app-ca" {
+				uploads = append(uploads, event)
+			}
+		}
+
+		if len(uploads) != 2 || uploads[0].Result != audit.ResultFailure || uploads[1].CertificateID != caCertID {
+			t.Errorf("got %+v, want the throttled attempt and the upload of %s", uploads, caCertID)
+		}
+	})
+
+	t.Run("events are not written once the audit log is closed", func(t *testing.T) {
+		audit.Close()
+
+		if _, err := target.ModifyCertificateName(client, newCertID, "app-v2"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := len(events()); got != len(recorded) {
+			t.Errorf("got %d events, want %d", got, len(recorded))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package tencent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+// CertificateTypeCA is the type of certificates holding the client CA of
+// mutual TLS, server certificates have type SVR.
+const CertificateTypeCA = "CA"
+
+// CAAlias is the alias of the CA certificate uploaded for a certificate.
+func (t *TencentSSLCertificate) CAAlias() string {
+	return fmt.Sprintf("%s-ca", t.CertificateName)
+}
+
+// CreateCACertificate uploads the CA certificate of the secret as a CA type
+// certificate, when FindCACertificate found none, and sets CACertificateID
+// to it.
+func (t *TencentSSLCertificate) CreateCACertificate(client SSLClient) (string, error) {
+	logger.Logger.Info(fmt.Sprintf("uploading ca certificate of %s as %s", t.CertificateName, t.CAAlias()))
+
+	publicKey, err := base64.StdEncoding.DecodeString(t.CACertificate)
+	if err != nil {
+		err := fmt.Errorf("unable to decode ca certificate")
+		return "", err
+	}
+
+	caCertID, err := t.UploadCACertificate(client, string(publicKey))
+	if err != nil {
+		return "", err
+	}
+
+	t.CACertificateID = caCertID
+
+	return caCertID, nil
+}
+
+// RetireCACertificate relabels a CA certificate uploaded before for an older
+// ca.crt "<alias>-v<timestamp>", it is not deleted since CLB listeners may
+// still hold it.
+func (t *TencentSSLCertificate) RetireCACertificate(client SSLClient, certID string) error {
+	versionAlias := fmt.Sprintf("%s-v%s", t.CAAlias(), time.Now().UTC().Format(versionTimeLayout))
+
+	logger.Logger.Info(fmt.Sprintf("keeping superseded ca certificate %s as %s", certID, versionAlias))
+
+	_, err := t.ModifyCertificateName(client, certID, versionAlias)
+	return err
+}
+
+// FindCACertificate returns the uploaded CA certificate matching the CA
+// certificate of the secret, empty when it has not been uploaded yet, and
+// the CA certificates uploaded before for an older ca.crt.
+func (t *TencentSSLCertificate) FindCACertificate(client SSLClient) (string, []string, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(t.CACertificate)
+	if err != nil {
+		err := fmt.Errorf("unable to decode ca certificate")
+		return "", nil, err
+	}
+
+	fingerprint, err := ParseCertificateFingerprint(publicKey)
+	if err != nil {
+		err := fmt.Errorf("invalid ca certificate of %s with error: %s", t.CertificateName, err)
+		return "", nil, err
+	}
+
+	alias := t.CAAlias()
+
+	certificates, err := t.ListCertificates(client, alias, t.Tags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var caCertID string
+	var superseded []string
+	for _, cert := range certificates {
+		if cert.Alias != alias || cert.CertificateType != CertificateTypeCA {
+			continue
+		}
+
+		detail, err := t.DescribeCertificateDetail(client, cert.CertificateID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if caCertID == "" && detail.Fingerprint.Equal(fingerprint) {
+			caCertID = cert.CertificateID
+			continue
+		}
+
+		superseded = append(superseded, cert.CertificateID)
+	}
+
+	return caCertID, superseded, nil
+}
+
+func (t *TencentSSLCertificate) UploadCACertificate(client SSLClient, publicKey string) (string, error) {
+	var certData CertificateData
+
+	request := sslCertificate.NewUploadCertificateRequest()
+	request.CertificatePublicKey = common.StringPtr(publicKey)
+	request.CertificateType = common.StringPtr(CertificateTypeCA)
+	request.Alias = common.StringPtr(t.CAAlias())
+	request.Repeatable = common.BoolPtr(true)
+	request.Tags = sslTags(t.Tags)
+
+	var response *sslCertificate.UploadCertificateResponse
+	err := withMutationRetry(t.Context, "UploadCertificate", func() error {
+		if err := waitRateLimit(t.Context, "UploadCertificate"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.UploadCertificateWithContext(t.Context, request)
+		if err != nil {
+			t.audit(audit.Event{Action: "UploadCertificate", Alias: t.CAAlias()}, nil, err)
+		}
+		return err
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to upload ca certificate of %s with error: %w", t.CertificateName, err)
+		return "", err
+	}
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		err := fmt.Errorf("invalid response while uploading ca certificate of %s with error: %s", t.CertificateName, err)
+		return "", err
+	}
+
+	err = json.Unmarshal(data, &certData)
+	if err != nil {
+		err := fmt.Errorf("unable to parse certificates response with error: %s", err)
+		return "", err
+	}
+
+	t.audit(audit.Event{Action: "UploadCertificate", CertificateID: certData.CertificateID, Alias: t.CAAlias()}, response, nil)
+
+	return certData.CertificateID, nil
+}
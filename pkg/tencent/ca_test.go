@@ -0,0 +1,114 @@
+package tencent
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+)
+
+func TestCACertificate(t *testing.T) {
+	client := fake.NewSSLClient()
+
+	caPEM, _ := testCertificate(t, "Tendo Test CA")
+	target := testTarget(t, "app", "app.example.com")
+	target.CACertificate = base64.StdEncoding.EncodeToString([]byte(caPEM))
+
+	// a server certificate under the ca alias is not the ca certificate
+	client.AddCertificate(fake.Certificate{
+		Alias:     target.CAAlias(),
+		PublicKey: caPEM,
+		Status:    fake.CertificateStatusIssued,
+		Tags:      target.Tags,
+	})
+
+	caCertID, superseded, err := target.FindCACertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if caCertID != "" || len(superseded) != 0 {
+		t.Fatalf("got ca certificate %q superseding %v before the upload, want none", caCertID, superseded)
+	}
+
+	uploaded, err := target.CreateCACertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("uploaded as a tagged ca certificate", func(t *testing.T) {
+		if target.CACertificateID != uploaded {
+			t.Errorf("got CACertificateID %s, want %s", target.CACertificateID, uploaded)
+		}
+
+		cert, ok := client.Certificate(uploaded)
+		if !ok {
+			t.Fatalf("ca certificate %s was not uploaded", uploaded)
+		}
+
+		if cert.CertificateType != CertificateTypeCA || cert.Alias != "app-ca" || cert.PrivateKey != "" {
+			t.Errorf("got %s certificate %s, want a CA certificate app-ca without private key", cert.CertificateType, cert.Alias)
+		}
+
+		if !reflect.DeepEqual(cert.Tags, target.Tags) {
+			t.Errorf("got tags %v, want %v", cert.Tags, target.Tags)
+		}
+	})
+
+	t.Run("uploaded certificate is found by its fingerprint", func(t *testing.T) {
+		caCertID, superseded, err := target.FindCACertificate(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if caCertID != uploaded || len(superseded) != 0 {
+			t.Errorf("got %s superseding %v, want %s", caCertID, superseded, uploaded)
+		}
+	})
+
+	t.Run("rotated ca supersedes the uploaded certificate", func(t *testing.T) {
+		rotatedPEM, _ := testCertificate(t, "Tendo Test CA")
+		rotated := testTarget(t, "app", "app.example.com")
+		rotated.CACertificate = base64.StdEncoding.EncodeToString([]byte(rotatedPEM))
+
+		caCertID, superseded, err := rotated.FindCACertificate(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if caCertID != "" || !reflect.DeepEqual(superseded, []string{uploaded}) {
+			t.Fatalf("got %q superseding %v, want no match superseding %s", caCertID, superseded, uploaded)
+		}
+
+		err = rotated.RetireCACertificate(client, uploaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, _ := client.Certificate(uploaded)
+		if !strings.HasPrefix(cert.Alias, "app-ca-v") {
+			t.Errorf("got alias %s, want the versioned alias app-ca-v<timestamp>", cert.Alias)
+		}
+
+		_, superseded, err = rotated.FindCACertificate(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(superseded) != 0 {
+			t.Errorf("got superseded %v, want the retired certificate left alone", superseded)
+		}
+	})
+
+	t.Run("invalid ca certificate", func(t *testing.T) {
+		invalid := testTarget(t, "app", "app.example.com")
+		invalid.CACertificate = base64.StdEncoding.EncodeToString([]byte("not a certificate"))
+
+		_, _, err := invalid.FindCACertificate(client)
+		if err == nil {
+			t.Error("got no error")
+		}
+	})
+}
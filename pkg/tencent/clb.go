@@ -0,0 +1,368 @@
+package tencent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/clb/v20180317"
+)
+
+// CLBClient is the part of the Tencent CLB API used to bind certificates to
+// listeners. It is satisfied by *clb.Client and by fake.CLBClient.
+type CLBClient interface {
+	ModifyListenerWithContext(ctx context.Context, request *clb.ModifyListenerRequest) (*clb.ModifyListenerResponse, error)
+	ModifyDomainAttributesWithContext(ctx context.Context, request *clb.ModifyDomainAttributesRequest) (*clb.ModifyDomainAttributesResponse, error)
+	DescribeListenersWithContext(ctx context.Context, request *clb.DescribeListenersRequest) (*clb.DescribeListenersResponse, error)
+}
+
+// CLBClientFactory, when set, replaces the SDK client built by
+// BuildCLBClient.
+var CLBClientFactory func(t *TencentSSLCertificate, region string) (CLBClient, error)
+
+var (
+	clbVerifyPollInterval = 2 * time.Second
+	clbVerifyPollAttempts = 15
+)
+
+// clbSSLModeMutual is the ssl mode of listeners verifying client
+// certificates against a ca certificate.
+const clbSSLModeMutual = "MUTUAL"
+
+// CLBListener is a listener the certificate is bound to. With a Domain the
+// certificate is bound to that domain of an SNI enabled HTTPS listener,
+// otherwise to the listener itself.
+type CLBListener struct {
+	Region         string
+	LoadBalancerID string
+	ListenerID     string
+	Domain         string
+}
+
+type CLBCertificate struct {
+	SSLMode  string `json:"SSLMode"`
+	CertID   string `json:"CertId"`
+	CertCaID string `json:"CertCaId"`
+}
+
+type clbRule struct {
+	Domain      string          `json:"Domain"`
+	Certificate *CLBCertificate `json:"Certificate"`
+}
+
+type clbListener struct {
+	ListenerID  string          `json:"ListenerId"`
+	Protocol    string          `json:"Protocol"`
+	Certificate *CLBCertificate `json:"Certificate"`
+	Rules       []clbRule       `json:"Rules"`
+}
+
+type clbListeners struct {
+	Listeners []clbListener `json:"Listeners"`
+}
+
+// CLBBindingMismatchError is returned when a listener still does not hold
+// the certificate after it was bound.
+type CLBBindingMismatchError struct {
+	Message       string
+	Listener      CLBListener
+	CertificateID string
+}
+
+func (e *CLBBindingMismatchError) Error() string {
+	return e.Message
+}
+
+func (l CLBListener) String() string {
+	if l.Domain == "" {
+		return fmt.Sprintf("%s/%s", l.LoadBalancerID, l.ListenerID)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", l.LoadBalancerID, l.ListenerID, l.Domain)
+}
+
+func (t *TencentSSLCertificate) BuildCLBClient(region string) (CLBClient, error) {
+	if CLBClientFactory != nil {
+		return CLBClientFactory(t, region)
+	}
+
+	profile := t.ClientOptions.profile("clb", t.ClientOptions.CLBEndpoint)
+
+	client, err := clb.NewClient(t.Credentials, region, profile)
+	if err != nil {
+		err := fmt.Errorf("unable to build tencent cloud clb client with error: %s", err)
+		return nil, err
+	}
+
+	transport, err := t.ClientOptions.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	if transport != nil {
+		client.WithHttpTransport(transport)
+	}
+
+	return client, nil
+}
+
+// BindCLBListeners binds certID to every configured listener which does not
+// hold it yet and reads each listener back to confirm the binding.
+func (t *TencentSSLCertificate) BindCLBListeners(certID string) error {
+	return t.eachCLBListener(func(client CLBClient, listener CLBListener) error {
+		return t.BindCLBListener(client, listener, certID)
+	})
+}
+
+// UnboundCLBListeners returns the configured listeners which do not hold
+// certID, or its CA certificate, yet.
+func (t *TencentSSLCertificate) UnboundCLBListeners(certID string) ([]CLBListener, error) {
+	var unbound []CLBListener
+
+	err := t.eachCLBListener(func(client CLBClient, listener CLBListener) error {
+		current, err := t.DescribeCLBCertificate(client, listener)
+		if err != nil {
+			return err
+		}
+
+		if !t.holdsCertificate(current, certID) {
+			unbound = append(unbound, listener)
+		}
+
+		return nil
+	})
+
+	return unbound, err
+}
+
+// eachCLBListener calls fn for every configured listener with a client of
+// the listener region.
+func (t *TencentSSLCertificate) eachCLBListener(fn func(client CLBClient, listener CLBListener) error) error {
+	clients := map[string]CLBClient{}
+
+	for _, listener := range t.CLBListeners {
+		region := listener.Region
+		if region == "" {
+			region = t.Region
+		}
+
+		client, ok := clients[region]
+		if !ok {
+			var err error
+			client, err = t.BuildCLBClient(region)
+			if err != nil {
+				return err
+			}
+			clients[region] = client
+		}
+
+		err := fn(client, listener)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *TencentSSLCertificate) BindCLBListener(client CLBClient, listener CLBListener, certID string) error {
+	current, err := t.DescribeCLBCertificate(client, listener)
+	if err != nil {
+		return err
+	}
+
+	if t.holdsCertificate(current, certID) {
+		logger.Logger.Info(fmt.Sprintf("clb listener %s already holds certificate %s", listener, certID))
+		return nil
+	}
+
+	// keep the ssl mode and client ca of mutual authentication listeners,
+	// unless the target syncs its own ca certificate
+	certificate := &clb.CertificateInput{
+		SSLMode: common.StringPtr("UNIDIRECTIONAL"),
+		CertId:  common.StringPtr(certID),
+	}
+	if current.SSLMode != "" {
+		certificate.SSLMode = common.StringPtr(current.SSLMode)
+	}
+	if current.CertCaID != "" {
+		certificate.CertCaId = common.StringPtr(current.CertCaID)
+	}
+	if t.CACertificateID != "" {
+		certificate.SSLMode = common.StringPtr(clbSSLModeMutual)
+		certificate.CertCaId = common.StringPtr(t.CACertificateID)
+	}
+
+	logger.Logger.Info(fmt.Sprintf("binding certificate %s to clb listener %s", certID, listener))
+
+	event := audit.Event{
+		Action:           "ModifyListener",
+		CertificateID:    certID,
+		OldCertificateID: current.CertID,
+		Resources:        []string{"clb/" + listener.String()},
+	}
+
+	if listener.Domain == "" {
+		request := clb.NewModifyListenerRequest()
+		request.LoadBalancerId = common.StringPtr(listener.LoadBalancerID)
+		request.ListenerId = common.StringPtr(listener.ListenerID)
+		request.Certificate = certificate
+
+		err = withMutationRetry(t.Context, "ModifyListener", func() error {
+			if err := waitRateLimit(t.Context, "ModifyListener"); err != nil {
+				return err
+			}
+
+			response, err := client.ModifyListenerWithContext(t.Context, request)
+			t.audit(event, response, err)
+			return err
+		})
+	} else {
+		event.Action = "ModifyDomainAttributes"
+		request := clb.NewModifyDomainAttributesRequest()
+		request.LoadBalancerId = common.StringPtr(listener.LoadBalancerID)
+		request.ListenerId = common.StringPtr(listener.ListenerID)
+		request.Domain = common.StringPtr(listener.Domain)
+		request.Certificate = certificate
+
+		err = withMutationRetry(t.Context, "ModifyDomainAttributes", func() error {
+			if err := waitRateLimit(t.Context, "ModifyDomainAttributes"); err != nil {
+				return err
+			}
+
+			response, err := client.ModifyDomainAttributesWithContext(t.Context, request)
+			t.audit(event, response, err)
+			return err
+		})
+	}
+	if err != nil {
+		err := fmt.Errorf("failed to bind certificate %s to clb listener %s with error: %w", certID, listener, err)
+		return err
+	}
+
+	return t.VerifyCLBListener(client, listener, certID)
+}
+
+// VerifyCLBListener reads the listener back until it reports certID. Domain
+// changes are applied asynchronously by the CLB API, so a few reads may
+// still show the previous certificate.
+func (t *TencentSSLCertificate) VerifyCLBListener(client CLBClient, listener CLBListener, certID string) error {
+	var current CLBCertificate
+
+	for attempt := 0; attempt < clbVerifyPollAttempts; attempt++ {
+		var err error
+		current, err = t.DescribeCLBCertificate(client, listener)
+		if err != nil {
+			return err
+		}
+
+		if t.holdsCertificate(current, certID) {
+			logger.Logger.Info(fmt.Sprintf("clb listener %s is verified to hold certificate %s", listener, certID))
+			return nil
+		}
+
+		select {
+		case <-t.Context.Done():
+			return t.Context.Err()
+		case <-time.After(clbVerifyPollInterval):
+		}
+	}
+
+	msg := fmt.Sprintf("clb listener %s holds certificate %s instead of %s", listener, current.CertID, certID)
+	err := &CLBBindingMismatchError{
+		Message:       msg,
+		Listener:      listener,
+		CertificateID: certID,
+	}
+	return err
+}
+
+// holdsCertificate reports whether a listener holds certID, and the ca
+// certificate of the target in mutual mode when it has one.
+func (t *TencentSSLCertificate) holdsCertificate(current CLBCertificate, certID string) bool {
+	if current.CertID != certID {
+		return false
+	}
+
+	if t.CACertificateID == "" {
+		return true
+	}
+
+	return current.SSLMode == clbSSLModeMutual && current.CertCaID == t.CACertificateID
+}
+
+// DescribeCLBCertificate returns the server certificate of the listener, or
+// of its domain when the listener has one configured.
+func (t *TencentSSLCertificate) DescribeCLBCertificate(client CLBClient, listener CLBListener) (CLBCertificate, error) {
+	var certificate CLBCertificate
+	var listeners clbListeners
+
+	request := clb.NewDescribeListenersRequest()
+	request.LoadBalancerId = common.StringPtr(listener.LoadBalancerID)
+	request.ListenerIds = common.StringPtrs([]string{listener.ListenerID})
+
+	var response *clb.DescribeListenersResponse
+	err := withRetry(t.Context, "DescribeListeners", func() error {
+		if err := waitRateLimit(t.Context, "DescribeListeners"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.DescribeListenersWithContext(t.Context, request)
+		return err
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to get clb listener %s with error: %w", listener, err)
+		return certificate, err
+	}
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		err := fmt.Errorf("invalid response while getting clb listener %s with error: %s", listener, err)
+		return certificate, err
+	}
+
+	err = json.Unmarshal(data, &listeners)
+	if err != nil {
+		err := fmt.Errorf("unable to parse clb listener response with error: %s", err)
+		return certificate, err
+	}
+
+	for _, item := range listeners.Listeners {
+		if item.ListenerID != listener.ListenerID {
+			continue
+		}
+
+		if listener.Domain == "" {
+			if item.Certificate != nil {
+				certificate = *item.Certificate
+			}
+
+			return certificate, nil
+		}
+
+		for _, rule := range item.Rules {
+			if rule.Domain != listener.Domain {
+				continue
+			}
+
+			if rule.Certificate != nil {
+				certificate = *rule.Certificate
+			}
+
+			return certificate, nil
+		}
+
+		// an unknown domain holds no certificate, binding reports it when
+		// the domain does not exist at all
+		return certificate, nil
+	}
+
+	err = fmt.Errorf("clb listener %s not found", listener)
+	return certificate, err
+}
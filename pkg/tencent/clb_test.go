@@ -0,0 +1,228 @@
+package tencent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/clb/v20180317"
+)
+
+// staleCLBClient accepts listener changes without applying them, like a
+// CLB API which has not caught up yet.
+type staleCLBClient struct {
+	*fake.CLBClient
+}
+
+func (c staleCLBClient) ModifyListenerWithContext(ctx context.Context, request *clb.ModifyListenerRequest) (*clb.ModifyListenerResponse, error) {
+	return clb.NewModifyListenerResponse(), nil
+}
+
+// testCLB returns a clb client checking certificates against an ssl client
+// holding an old and a new certificate and a ca certificate, and their ids.
+func testCLB(t *testing.T) (*fake.CLBClient, string, string, string) {
+	t.Helper()
+
+	ssl := fake.NewSSLClient()
+	certPEM, keyPEM := testCertificate(t, "app.example.com")
+	caPEM, _ := testCertificate(t, "ca.example.com")
+
+	oldCertID := ssl.AddCertificate(fake.Certificate{Alias: "app", PublicKey: certPEM, PrivateKey: keyPEM, Status: fake.CertificateStatusIssued})
+	newCertID := ssl.AddCertificate(fake.Certificate{Alias: "app", PublicKey: certPEM, PrivateKey: keyPEM, Status: fake.CertificateStatusIssued})
+	caCertID := ssl.AddCertificate(fake.Certificate{Alias: "app-ca", CertificateType: "CA", PublicKey: caPEM, Status: fake.CertificateStatusIssued})
+
+	return fake.NewCLBClient(ssl), oldCertID, newCertID, caCertID
+}
+
+func TestBindCLBListener(t *testing.T) {
+	t.Run("listener certificate is replaced", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, _ := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: oldCertID})
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, _ := client.Listener("lb-1", "lbl-1")
+		if listener.CertID != newCertID || listener.SSLMode != "UNIDIRECTIONAL" {
+			t.Errorf("listener holds %s in %s mode, want %s in UNIDIRECTIONAL mode", listener.CertID, listener.SSLMode, newCertID)
+		}
+	})
+
+	t.Run("only the configured domain is replaced", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, _ := testCLB(t)
+		client.AddListener(fake.Listener{
+			LoadBalancerID: "lb-1",
+			ListenerID:     "lbl-1",
+			Domains:        map[string]string{"app.example.com": oldCertID, "other.example.com": oldCertID},
+		})
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", Domain: "app.example.com"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, _ := client.Listener("lb-1", "lbl-1")
+		if listener.Domains["app.example.com"] != newCertID {
+			t.Errorf("domain holds %s, want %s", listener.Domains["app.example.com"], newCertID)
+		}
+
+		if listener.Domains["other.example.com"] != oldCertID {
+			t.Errorf("other domain holds %s, want it to keep %s", listener.Domains["other.example.com"], oldCertID)
+		}
+	})
+
+	t.Run("bound listener is not modified", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, _, newCertID, _ := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: newCertID})
+		client.InjectError("ModifyListener", "InternalError", "listener was modified", 0)
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("mutual listener keeps its mode and client ca", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, caCertID := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", SSLMode: clbSSLModeMutual, CertID: oldCertID, CertCaID: caCertID})
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, _ := client.Listener("lb-1", "lbl-1")
+		if listener.CertID != newCertID || listener.SSLMode != clbSSLModeMutual || listener.CertCaID != caCertID {
+			t.Errorf("listener holds %s in %s mode with ca %s, want %s in MUTUAL mode with ca %s", listener.CertID, listener.SSLMode, listener.CertCaID, newCertID, caCertID)
+		}
+	})
+
+	t.Run("mutual domain keeps its client ca", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, caCertID := testCLB(t)
+		client.AddListener(fake.Listener{
+			LoadBalancerID: "lb-1",
+			ListenerID:     "lbl-1",
+			Domains:        map[string]string{"app.example.com": oldCertID},
+			DomainCAs:      map[string]string{"app.example.com": caCertID},
+		})
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", Domain: "app.example.com"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, _ := client.Listener("lb-1", "lbl-1")
+		if listener.Domains["app.example.com"] != newCertID || listener.DomainCAs["app.example.com"] != caCertID {
+			t.Errorf("domain holds %s with ca %s, want %s with ca %s", listener.Domains["app.example.com"], listener.DomainCAs["app.example.com"], newCertID, caCertID)
+		}
+	})
+
+	t.Run("ca certificate of the target switches to mutual mode", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, caCertID := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: oldCertID})
+		target.CACertificateID = caCertID
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, _ := client.Listener("lb-1", "lbl-1")
+		if listener.SSLMode != clbSSLModeMutual || listener.CertCaID != caCertID {
+			t.Errorf("listener is in %s mode with ca %s, want MUTUAL mode with ca %s", listener.SSLMode, listener.CertCaID, caCertID)
+		}
+	})
+
+	t.Run("unknown domain fails", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+		client, oldCertID, newCertID, _ := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", Domains: map[string]string{"other.example.com": oldCertID}})
+
+		err := target.BindCLBListener(client, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", Domain: "app.example.com"}, newCertID)
+		if err == nil {
+			t.Fatal("got no error")
+		}
+	})
+}
+
+func TestVerifyCLBListenerTimeout(t *testing.T) {
+	interval, attempts := clbVerifyPollInterval, clbVerifyPollAttempts
+	clbVerifyPollInterval, clbVerifyPollAttempts = time.Millisecond, 3
+	t.Cleanup(func() {
+		clbVerifyPollInterval, clbVerifyPollAttempts = interval, attempts
+	})
+
+	target := testTarget(t, "app", "app.example.com")
+	client, oldCertID, newCertID, _ := testCLB(t)
+	client.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: oldCertID})
+
+	err := target.BindCLBListener(staleCLBClient{client}, CLBListener{LoadBalancerID: "lb-1", ListenerID: "lbl-1"}, newCertID)
+
+	mismatch := &CLBBindingMismatchError{}
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got error %v, want a CLBBindingMismatchError", err)
+	}
+
+	if mismatch.CertificateID != newCertID {
+		t.Errorf("got mismatch for %s, want %s", mismatch.CertificateID, newCertID)
+	}
+}
+
+func TestBindCLBListeners(t *testing.T) {
+	target := testTarget(t, "app", "app.example.com")
+	target.Region = "ap-singapore"
+
+	clients := map[string]*fake.CLBClient{}
+	var newCertID string
+	for _, region := range []string{"ap-singapore", "ap-jakarta"} {
+		client, oldCertID, certID, _ := testCLB(t)
+		client.AddListener(fake.Listener{LoadBalancerID: "lb-" + region, ListenerID: "lbl-1", CertID: oldCertID})
+		clients[region] = client
+		newCertID = certID
+	}
+
+	// both fake ssl clients number their certificates alike
+	CLBClientFactory = func(t *TencentSSLCertificate, region string) (CLBClient, error) {
+		return clients[region], nil
+	}
+	t.Cleanup(func() {
+		CLBClientFactory = nil
+	})
+
+	target.CLBListeners = []CLBListener{
+		{LoadBalancerID: "lb-ap-singapore", ListenerID: "lbl-1"},
+		{Region: "ap-jakarta", LoadBalancerID: "lb-ap-jakarta", ListenerID: "lbl-1"},
+	}
+
+	err := target.BindCLBListeners(newCertID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for region, client := range clients {
+		listener, _ := client.Listener("lb-"+region, "lbl-1")
+		if listener.CertID != newCertID {
+			t.Errorf("listener in %s holds %s, want %s", region, listener.CertID, newCertID)
+		}
+	}
+
+	unbound, err := target.UnboundCLBListeners(newCertID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unbound) != 0 {
+		t.Errorf("got unbound listeners %v after binding", unbound)
+	}
+}
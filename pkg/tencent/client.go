@@ -51,4 +51,3 @@ func BuildCredentials() (common.CredentialIface, error) {
 
 	return creds, nil
 }
-
@@ -0,0 +1,143 @@
+package tencent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/metrics"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+)
+
+// Lifetimes of cached credentials. Static keys do not expire, but they are
+// rebuilt now and then so a rotated Kubernetes secret or env is picked up.
+// Temporary credentials of TKE OIDC and CVM roles default to 2 hours.
+const (
+	staticCredentialLifetime  = 5 * time.Minute
+	defaultCredentialLifetime = 30 * time.Minute
+)
+
+// CredentialSource builds fresh credentials and reports how long they are
+// valid for.
+type CredentialSource func() (common.CredentialIface, time.Duration, error)
+
+// CredentialManager caches credentials by account name, an empty name being
+// the global credentials, and rebuilds them once three quarters of their
+// lifetime has passed, so callers never get credentials that are about to
+// expire. It is safe for concurrent use and meant to be shared by all watch
+// targets.
+type CredentialManager struct {
+	mu      sync.Mutex
+	entries map[string]*credentialEntry
+	now     func() time.Time
+}
+
+type credentialEntry struct {
+	mu        sync.Mutex
+	creds     common.CredentialIface
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+var credentialRefreshes = metrics.NewCounterVec(
+	"tendo_tencent_credential_refreshes_total",
+	"Tencent Cloud credentials built by the credential manager, by result.",
+	"account",
+	"result",
+)
+
+func NewCredentialManager() *CredentialManager {
+	return &CredentialManager{
+		entries: map[string]*credentialEntry{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached credentials of account, building them with source when
+// there are none yet or they are due for a refresh. When a refresh fails the
+// cached credentials are returned as long as they have not expired.
+func (m *CredentialManager) Get(account string, source CredentialSource) (common.CredentialIface, error) {
+	m.mu.Lock()
+	entry, ok := m.entries[account]
+	if !ok {
+		entry = &credentialEntry{}
+		m.entries[account] = entry
+	}
+	m.mu.Unlock()
+
+	// one refresh per account at a time, concurrent targets wait for it instead
+	// of exchanging tokens themselves
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	now := m.now()
+	if entry.creds != nil && now.Before(entry.refreshAt) {
+		return entry.creds, nil
+	}
+
+	label := account
+	if label == "" {
+		label = "default"
+	}
+
+	creds, lifetime, err := source()
+	if err != nil {
+		credentialRefreshes.Inc(label, "error")
+
+		if entry.creds != nil && now.Before(entry.expiresAt) {
+			logger.Logger.Error(fmt.Sprintf("unable to refresh credentials of account %s, using cached credentials until %s, error: %s", label, entry.expiresAt.Format(time.RFC3339), err))
+			return entry.creds, nil
+		}
+
+		return nil, err
+	}
+
+	credentialRefreshes.Inc(label, "success")
+	logger.Logger.Debug(fmt.Sprintf("refreshed credentials of account %s, valid for %s", label, lifetime))
+
+	entry.creds = creds
+	entry.expiresAt = now.Add(lifetime)
+	entry.refreshAt = now.Add(lifetime * 3 / 4)
+
+	return creds, nil
+}
+
+// Invalidate drops the cached credentials of account, e.g. after the API
+// rejected them.
+func (m *CredentialManager) Invalidate(account string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, account)
+}
+
+// AccountCredentialSource builds the credentials of account.
+func AccountCredentialSource(account Account) CredentialSource {
+	return func() (common.CredentialIface, time.Duration, error) {
+		creds, err := BuildAccountCredentials(account)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		lifetime := staticCredentialLifetime
+		if account.OIDC != nil {
+			lifetime = time.Duration(account.OIDC.DurationSeconds) * time.Second
+			if lifetime <= 0 {
+				lifetime = defaultOIDCDurationSeconds * time.Second
+			}
+		}
+
+		return creds, lifetime, nil
+	}
+}
+
+// DefaultCredentialSource builds the global credentials of BuildCredentials.
+func DefaultCredentialSource() (common.CredentialIface, time.Duration, error) {
+	creds, err := BuildCredentials()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return creds, defaultCredentialLifetime, nil
+}
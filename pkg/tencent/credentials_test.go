@@ -0,0 +1,175 @@
+package tencent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+)
+
+func TestCredentialManager(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// testSource hands out numbered credentials valid for an hour, or
+	// fails while failing is set
+	type testSource struct {
+		builds  int
+		failing bool
+	}
+
+	build := func(source *testSource) CredentialSource {
+		return func() (common.CredentialIface, time.Duration, error) {
+			if source.failing {
+				return nil, 0, errors.New("token exchange failed")
+			}
+
+			source.builds++
+			return common.NewCredential(fmt.Sprintf("AKID%d", source.builds), "secret"), time.Hour, nil
+		}
+	}
+
+	newManager := func(now *time.Time) *CredentialManager {
+		manager := NewCredentialManager()
+		manager.now = func() time.Time {
+			return *now
+		}
+
+		return manager
+	}
+
+	get := func(t *testing.T, manager *CredentialManager, account string, source CredentialSource) string {
+		t.Helper()
+
+		creds, err := manager.Get(account, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return creds.GetSecretId()
+	}
+
+	t.Run("refreshed after three quarters of the lifetime", func(t *testing.T) {
+		now := start
+		manager := newManager(&now)
+		source := &testSource{}
+
+		steps := []struct {
+			after time.Duration
+			want  string
+		}{
+			{after: 0, want: "AKID1"},
+			{after: 44 * time.Minute, want: "AKID1"},
+			{after: 45 * time.Minute, want: "AKID2"},
+			{after: 89 * time.Minute, want: "AKID2"},
+			{after: 90 * time.Minute, want: "AKID3"},
+		}
+
+		for _, step := range steps {
+			now = start.Add(step.after)
+
+			if got := get(t, manager, "prod", build(source)); got != step.want {
+				t.Errorf("after %s got %s, want %s", step.after, got, step.want)
+			}
+		}
+	})
+
+	t.Run("cached credentials outlive a failed refresh until they expire", func(t *testing.T) {
+		now := start
+		manager := newManager(&now)
+		source := &testSource{}
+
+		get(t, manager, "prod", build(source))
+
+		source.failing = true
+		now = start.Add(50 * time.Minute)
+
+		if got := get(t, manager, "prod", build(source)); got != "AKID1" {
+			t.Errorf("got %s, want the cached AKID1", got)
+		}
+
+		now = start.Add(time.Hour)
+
+		_, err := manager.Get("prod", build(source))
+		if err == nil {
+			t.Error("got expired credentials, want the refresh error")
+		}
+	})
+
+	t.Run("accounts are cached apart and invalidated alone", func(t *testing.T) {
+		now := start
+		manager := newManager(&now)
+		prod, staging := &testSource{}, &testSource{}
+
+		get(t, manager, "prod", build(prod))
+		get(t, manager, "staging", build(staging))
+
+		manager.Invalidate("prod")
+
+		if got := get(t, manager, "prod", build(prod)); got != "AKID2" {
+			t.Errorf("prod got %s, want rebuilt AKID2", got)
+		}
+
+		if got := get(t, manager, "staging", build(staging)); got != "AKID1" {
+			t.Errorf("staging got %s, want cached AKID1", got)
+		}
+	})
+}
+
+func TestAccountCredentialSource(t *testing.T) {
+	t.Setenv("TENCENTCLOUD_BILLING_SECRET_ID", "AKIDbilling")
+	t.Setenv("TENCENTCLOUD_BILLING_SECRET_KEY", "billing-secret")
+
+	tests := []struct {
+		name     string
+		account  Account
+		secretID string
+		token    string
+		lifetime time.Duration
+	}{
+		{
+			name:     "static keys",
+			account:  Account{Name: "prod", SecretID: "AKIDprod", SecretKey: "prod-secret"},
+			secretID: "AKIDprod",
+			lifetime: staticCredentialLifetime,
+		},
+		{
+			name:     "static keys with token",
+			account:  Account{Name: "prod", SecretID: "AKIDprod", SecretKey: "prod-secret", Token: "prod-token"},
+			secretID: "AKIDprod",
+			token:    "prod-token",
+			lifetime: staticCredentialLifetime,
+		},
+		{
+			name:     "env prefix",
+			account:  Account{Name: "billing", EnvPrefix: "TENCENTCLOUD_BILLING_"},
+			secretID: "AKIDbilling",
+			lifetime: staticCredentialLifetime,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			creds, lifetime, err := AccountCredentialSource(test.account)()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if creds.GetSecretId() != test.secretID || creds.GetToken() != test.token {
+				t.Errorf("got %s with token %q, want %s with token %q", creds.GetSecretId(), creds.GetToken(), test.secretID, test.token)
+			}
+
+			if lifetime != test.lifetime {
+				t.Errorf("got lifetime %s, want %s", lifetime, test.lifetime)
+			}
+		})
+	}
+
+	t.Run("missing secret key", func(t *testing.T) {
+		_, _, err := AccountCredentialSource(Account{Name: "prod", SecretID: "AKIDprod"})()
+		if err == nil {
+			t.Error("got no error")
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package tencent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeployStatus is the status of a deploy record, or of an instance of a
+// deploy record, as reported by the Tencent SSL API.
+type DeployStatus int
+
+// A failed deployment which Tencent Cloud moved back to the previous
+// certificate on its own ends in DeployStatusRollbackSucceeded or
+// DeployStatusRollbackFailed.
+const (
+	DeployStatusPending           DeployStatus = 0
+	DeployStatusSuccess           DeployStatus = 1
+	DeployStatusFailed            DeployStatus = 2
+	DeployStatusDeploying         DeployStatus = 3
+	DeployStatusRollbackSucceeded DeployStatus = 4
+	DeployStatusRollbackFailed    DeployStatus = 5
+)
+
+func (s DeployStatus) String() string {
+	switch s {
+	case DeployStatusPending:
+		return "pending"
+	case DeployStatusSuccess:
+		return "succeeded"
+	case DeployStatusFailed:
+		return "failed"
+	case DeployStatusDeploying:
+		return "deploying"
+	case DeployStatusRollbackSucceeded:
+		return "rolled back"
+	case DeployStatusRollbackFailed:
+		return "rollback failed"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Done reports whether the deployment finished, successfully or not. Status
+// codes tendo does not know are treated as still running.
+func (s DeployStatus) Done() bool {
+	return s == DeployStatusSuccess || s.Failed()
+}
+
+// Failed reports whether the certificate was not deployed, whether or not
+// the deployment was rolled back since.
+func (s DeployStatus) Failed() bool {
+	return s == DeployStatusFailed || s == DeployStatusRollbackSucceeded || s == DeployStatusRollbackFailed
+}
+
+// DeploymentGroup is the combined status of the deploy records of one
+// resource type in one region. Global resource types have no region.
+type DeploymentGroup struct {
+	ResourceType string
+	Region       string
+	Status       DeployStatus
+	RecordIDs    []int
+}
+
+// DeploymentSummary sorts the deploy records of a certificate update by
+// outcome. A record which is neither done nor failed is pending.
+type DeploymentSummary struct {
+	Pending   []CertificateDeployRecord
+	Succeeded []CertificateDeployRecord
+	Failed    []CertificateDeployRecord
+	Groups    []DeploymentGroup
+}
+
+// SummarizeDeployment builds the summary of records. A group is failed when
+// any of its records failed, with the worst rollback status among them,
+// pending when any is still running and succeeded otherwise.
+func SummarizeDeployment(records []CertificateDeployRecord) DeploymentSummary {
+	var summary DeploymentSummary
+	groups := map[string]*DeploymentGroup{}
+
+	for _, record := range records {
+		switch {
+		case record.Status.Failed():
+			summary.Failed = append(summary.Failed, record)
+		case record.Status == DeployStatusSuccess:
+			summary.Succeeded = append(summary.Succeeded, record)
+		default:
+			summary.Pending = append(summary.Pending, record)
+		}
+
+		regions := record.Regions
+		if len(regions) == 0 {
+			regions = []string{""}
+		}
+
+		for _, resourceType := range record.ResourceTypes {
+			for _, region := range regions {
+				key := resourceType + "/" + region
+
+				group, ok := groups[key]
+				if !ok {
+					group = &DeploymentGroup{
+						ResourceType: resourceType,
+						Region:       region,
+						Status:       DeployStatusSuccess,
+					}
+					groups[key] = group
+				}
+
+				group.RecordIDs = append(group.RecordIDs, record.ID)
+				group.Status = worseStatus(group.Status, record.Status)
+			}
+		}
+	}
+
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		if summary.Groups[i].ResourceType != summary.Groups[j].ResourceType {
+			return summary.Groups[i].ResourceType < summary.Groups[j].ResourceType
+		}
+		return summary.Groups[i].Region < summary.Groups[j].Region
+	})
+
+	return summary
+}
+
+// Total is the number of deploy records in the summary.
+func (s DeploymentSummary) Total() int {
+	return len(s.Pending) + len(s.Succeeded) + len(s.Failed)
+}
+
+// Done reports whether there are records and none of them is still running.
+func (s DeploymentSummary) Done() bool {
+	return len(s.Pending) == 0 && s.Total() > 0
+}
+
+// PartiallySucceeded reports whether some records succeeded while others
+// failed, leaving resources on different certificates.
+func (s DeploymentSummary) PartiallySucceeded() bool {
+	return len(s.Succeeded) > 0 && len(s.Failed) > 0
+}
+
+func (s DeploymentSummary) String() string {
+	var groups []string
+	for _, group := range s.Groups {
+		name := group.ResourceType
+		if group.Region != "" {
+			name = fmt.Sprintf("%s/%s", group.ResourceType, group.Region)
+		}
+
+		groups = append(groups, fmt.Sprintf("%s %s", name, group.Status))
+	}
+
+	return fmt.Sprintf("%d pending, %d succeeded, %d failed deploy records [%s]", len(s.Pending), len(s.Succeeded), len(s.Failed), strings.Join(groups, ", "))
+}
+
+// failedStatuses lists the failed statuses from worst to least bad, a
+// failed rollback leaves resources on the new certificate.
+var failedStatuses = []DeployStatus{DeployStatusRollbackFailed, DeployStatusFailed, DeployStatusRollbackSucceeded}
+
+func worseStatus(current DeployStatus, status DeployStatus) DeployStatus {
+	for _, failed := range failedStatuses {
+		if current == failed || status == failed {
+			return failed
+		}
+	}
+
+	if !current.Done() {
+		return current
+	}
+
+	if !status.Done() {
+		return status
+	}
+
+	return DeployStatusSuccess
+}
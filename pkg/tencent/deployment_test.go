@@ -0,0 +1,164 @@
+package tencent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeployStatusDone(t *testing.T) {
+	tests := []struct {
+		status DeployStatus
+		done   bool
+		failed bool
+	}{
+		{status: DeployStatusPending},
+		{status: DeployStatusSuccess, done: true},
+		{status: DeployStatusFailed, done: true, failed: true},
+		{status: DeployStatusDeploying},
+		{status: DeployStatusRollbackSucceeded, done: true, failed: true},
+		{status: DeployStatusRollbackFailed, done: true, failed: true},
+		{status: DeployStatus(9)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status.String(), func(t *testing.T) {
+			if got := test.status.Done(); got != test.done {
+				t.Errorf("Done = %t, want %t", got, test.done)
+			}
+
+			if got := test.status.Failed(); got != test.failed {
+				t.Errorf("Failed = %t, want %t", got, test.failed)
+			}
+		})
+	}
+}
+
+func TestSummarizeDeployment(t *testing.T) {
+	record := func(id int, status DeployStatus, resourceType string, regions ...string) CertificateDeployRecord {
+		return CertificateDeployRecord{
+			ID:            id,
+			ResourceTypes: []string{resourceType},
+			Regions:       regions,
+			Status:        status,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		records   []CertificateDeployRecord
+		pending   []int
+		succeeded []int
+		failed    []int
+		done      bool
+		partial   bool
+		groups    []DeploymentGroup
+	}{
+		{
+			name: "no records",
+		},
+		{
+			// the first record used to be skipped, so a single running
+			// record was reported done
+			name:    "one running record",
+			records: []CertificateDeployRecord{record(1, DeployStatusDeploying, "cdn")},
+			pending: []int{1},
+			groups:  []DeploymentGroup{{ResourceType: "cdn", Status: DeployStatusDeploying, RecordIDs: []int{1}}},
+		},
+		{
+			name:      "one succeeded record",
+			records:   []CertificateDeployRecord{record(1, DeployStatusSuccess, "cdn")},
+			succeeded: []int{1},
+			done:      true,
+			groups:    []DeploymentGroup{{ResourceType: "cdn", Status: DeployStatusSuccess, RecordIDs: []int{1}}},
+		},
+		{
+			name: "first record running",
+			records: []CertificateDeployRecord{
+				record(1, DeployStatusPending, "clb", "ap-singapore"),
+				record(2, DeployStatusSuccess, "clb", "ap-singapore"),
+			},
+			pending:   []int{1},
+			succeeded: []int{2},
+			groups:    []DeploymentGroup{{ResourceType: "clb", Region: "ap-singapore", Status: DeployStatusPending, RecordIDs: []int{1, 2}}},
+		},
+		{
+			name: "partial success grouped by resource type and region",
+			records: []CertificateDeployRecord{
+				record(1, DeployStatusSuccess, "clb", "ap-singapore", "ap-jakarta"),
+				record(2, DeployStatusFailed, "cdn"),
+			},
+			succeeded: []int{1},
+			failed:    []int{2},
+			done:      true,
+			partial:   true,
+			groups: []DeploymentGroup{
+				{ResourceType: "cdn", Status: DeployStatusFailed, RecordIDs: []int{2}},
+				{ResourceType: "clb", Region: "ap-jakarta", Status: DeployStatusSuccess, RecordIDs: []int{1}},
+				{ResourceType: "clb", Region: "ap-singapore", Status: DeployStatusSuccess, RecordIDs: []int{1}},
+			},
+		},
+		{
+			name: "rolled back records failed",
+			records: []CertificateDeployRecord{
+				record(1, DeployStatusRollbackSucceeded, "cdn"),
+				record(2, DeployStatusFailed, "cdn"),
+				record(3, DeployStatusRollbackSucceeded, "waf"),
+			},
+			failed: []int{1, 2, 3},
+			done:   true,
+			groups: []DeploymentGroup{
+				{ResourceType: "cdn", Status: DeployStatusFailed, RecordIDs: []int{1, 2}},
+				{ResourceType: "waf", Status: DeployStatusRollbackSucceeded, RecordIDs: []int{3}},
+			},
+		},
+		{
+			name: "failed rollback is the worst status",
+			records: []CertificateDeployRecord{
+				record(1, DeployStatusFailed, "cdn"),
+				record(2, DeployStatusRollbackFailed, "cdn"),
+				record(3, DeployStatusDeploying, "cdn"),
+			},
+			pending: []int{3},
+			failed:  []int{1, 2},
+			groups:  []DeploymentGroup{{ResourceType: "cdn", Status: DeployStatusRollbackFailed, RecordIDs: []int{1, 2, 3}}},
+		},
+	}
+
+	ids := func(records []CertificateDeployRecord) []int {
+		var result []int
+		for _, record := range records {
+			result = append(result, record.ID)
+		}
+		return result
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summary := SummarizeDeployment(test.records)
+
+			if got := ids(summary.Pending); !reflect.DeepEqual(got, test.pending) {
+				t.Errorf("got pending records %v, want %v", got, test.pending)
+			}
+
+			if got := ids(summary.Succeeded); !reflect.DeepEqual(got, test.succeeded) {
+				t.Errorf("got succeeded records %v, want %v", got, test.succeeded)
+			}
+
+			if got := ids(summary.Failed); !reflect.DeepEqual(got, test.failed) {
+				t.Errorf("got failed records %v, want %v", got, test.failed)
+			}
+
+			if got := summary.Done(); got != test.done {
+				t.Errorf("Done = %t, want %t", got, test.done)
+			}
+
+			if got := summary.PartiallySucceeded(); got != test.partial {
+				t.Errorf("PartiallySucceeded = %t, want %t", got, test.partial)
+			}
+
+			if !reflect.DeepEqual(summary.Groups, test.groups) {
+				t.Errorf("got groups %+v, want %+v", summary.Groups, test.groups)
+			}
+		})
+	}
+}
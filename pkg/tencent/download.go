@@ -0,0 +1,152 @@
+package tencent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+// CertificateDownload is a certificate read back from Tencent Cloud to be
+// written into a Kubernetes secret.
+type CertificateDownload struct {
+	CertificateID string
+	PublicKey     string
+	PrivateKey    string
+	Fingerprint   CertificateFingerprint
+}
+
+// beijing is the time zone of the SSL API, end times are only compared
+// with each other so a fixed offset does.
+var beijing = time.FixedZone("CST", 8*60*60)
+
+type certificateKeyPair struct {
+	CertificatePublicKey  string `json:"CertificatePublicKey"`
+	CertificatePrivateKey string `json:"CertificatePrivateKey"`
+}
+
+// FindLatestCertificate returns the ID of the certificate to download, the
+// certificate matching the alias or domain which expires last, so renewed
+// certificates, which Tencent Cloud issues under a new ID, are followed.
+func (t *TencentSSLCertificate) FindLatestCertificate(client SSLClient) (string, error) {
+	latest, err := t.findLatestCertificate(client)
+	if err != nil {
+		return "", err
+	}
+
+	return latest.CertificateID, nil
+}
+
+func (t *TencentSSLCertificate) findLatestCertificate(client SSLClient) (CertificateData, error) {
+	matched, err := t.findCertificates(client, nil)
+	if err != nil {
+		return CertificateData{}, err
+	}
+
+	if len(matched) < 1 {
+		msg := fmt.Sprintf("certificate with name or id %s not found", t.CertificateName)
+		err := fmt.Errorf("%w", &CertificateNotFoundError{
+			Message: msg,
+		})
+		return CertificateData{}, err
+	}
+
+	latest := matched[0]
+	for _, cert := range matched[1:] {
+		if certificateEndTime(cert).After(certificateEndTime(latest)) {
+			latest = cert
+		}
+	}
+
+	if len(matched) > 1 {
+		logger.Logger.Info(fmt.Sprintf("%d certificates match %s, using %s which expires last", len(matched), t.CertificateName, latest.CertificateID))
+	}
+
+	return latest, nil
+}
+
+// DownloadCertificate reads the certificate chain and private key of certID.
+// Tencent Cloud only returns private keys of uploaded certificates and of
+// certificates whose key it generated, others cannot be downloaded.
+func (t *TencentSSLCertificate) DownloadCertificate(client SSLClient, certID string) (CertificateDownload, error) {
+	var keyPair certificateKeyPair
+
+	download := CertificateDownload{
+		CertificateID: certID,
+	}
+
+	request := sslCertificate.NewDescribeCertificateDetailRequest()
+	request.CertificateId = common.StringPtr(certID)
+
+	var response *sslCertificate.DescribeCertificateDetailResponse
+	err := withRetry(t.Context, "DescribeCertificateDetail", func() error {
+		if err := waitRateLimit(t.Context, "DescribeCertificateDetail"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.DescribeCertificateDetailWithContext(t.Context, request)
+		return err
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to download certificate %s with error: %w", certID, err)
+		return download, err
+	}
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		err := fmt.Errorf("invalid response while downloading certificate %s with error: %s", certID, err)
+		return download, err
+	}
+
+	err = json.Unmarshal(data, &keyPair)
+	if err != nil {
+		err := fmt.Errorf("unable to parse certificate detail response with error: %s", err)
+		return download, err
+	}
+
+	if keyPair.CertificatePublicKey == "" {
+		err := fmt.Errorf("certificate %s has no certificate to download", certID)
+		return download, err
+	}
+
+	if keyPair.CertificatePrivateKey == "" {
+		err := fmt.Errorf("private key of certificate %s is not available for download", certID)
+		return download, err
+	}
+
+	fingerprint, err := ParseCertificateFingerprint([]byte(keyPair.CertificatePublicKey))
+	if err != nil {
+		err := fmt.Errorf("unable to fingerprint certificate id %s with error: %s", certID, err)
+		return download, err
+	}
+
+	matched, err := PrivateKeyMatches(fingerprint, []byte(keyPair.CertificatePrivateKey))
+	if err != nil {
+		return download, err
+	}
+
+	if !matched {
+		err := fmt.Errorf("private key of certificate %s does not match its certificate", certID)
+		return download, err
+	}
+
+	download.PublicKey = keyPair.CertificatePublicKey
+	download.PrivateKey = keyPair.CertificatePrivateKey
+	download.Fingerprint = fingerprint
+
+	return download, nil
+}
+
+func certificateEndTime(cert CertificateData) time.Time {
+	endTime, err := time.ParseInLocation(certificateTimeLayout, cert.CertEndTime, beijing)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return endTime
+}
@@ -0,0 +1,53 @@
+package tencent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+)
+
+func TestFindLatestCertificate(t *testing.T) {
+	client := fake.NewSSLClient()
+	target := testTarget(t, "shop", "shop.example.com")
+
+	// tencent cloud issues a renewal under a new id with the same alias
+	issued, issuedKey := testCertificate(t, "shop.example.com")
+	expiring := client.AddCertificate(fake.Certificate{
+		Alias:       "shop",
+		PublicKey:   issued,
+		PrivateKey:  issuedKey,
+		Status:      fake.CertificateStatusIssued,
+		CertEndTime: time.Now().Add(7 * 24 * time.Hour),
+	})
+
+	renewed, renewedKey := testCertificate(t, "shop.example.com")
+	renewal := client.AddCertificate(fake.Certificate{
+		Alias:       "shop",
+		PublicKey:   renewed,
+		PrivateKey:  renewedKey,
+		Status:      fake.CertificateStatusIssued,
+		CertEndTime: time.Now().Add(365 * 24 * time.Hour),
+	})
+
+	// an id left from the last pull does not pin the expiring certificate
+	target.CertificateID = expiring
+
+	certID, err := target.FindLatestCertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if certID != renewal {
+		t.Fatalf("got %s, want the renewal %s", certID, renewal)
+	}
+
+	download, err := target.DownloadCertificate(client, certID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if download.PublicKey != renewed || download.PrivateKey != renewedKey {
+		t.Error("downloaded key pair is not the one of the renewal")
+	}
+}
@@ -0,0 +1,378 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/clb/v20180317"
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+)
+
+// Listener is an HTTPS listener of a fake load balancer. Domains holds the
+// certificate of every domain of an SNI enabled listener, DomainCAs the client
+// CA of domains using mutual authentication.
+type Listener struct {
+	LoadBalancerID string
+	ListenerID     string
+	Protocol       string
+	SSLMode        string
+	CertID         string
+	CertCaID       string
+	Domains        map[string]string
+	DomainCAs      map[string]string
+}
+
+// CLBClient is a fake Tencent CLB API limited to listener certificates. It
+// checks certificate IDs against the SSLClient it was created with. It is
+// safe for concurrent use.
+type CLBClient struct {
+	// AutoCreate creates unknown listeners when they are described or
+	// modified, and unknown domains when a certificate is bound to them,
+	// instead of failing.
+	AutoCreate bool
+
+	mu        sync.Mutex
+	ssl       *SSLClient
+	listeners map[string]*Listener
+	errors    map[string]*injectedError
+}
+
+func NewCLBClient(ssl *SSLClient) *CLBClient {
+	return &CLBClient{
+		ssl:       ssl,
+		listeners: map[string]*Listener{},
+		errors:    map[string]*injectedError{},
+	}
+}
+
+// AddListener stores a listener. A listener with domains is SNI enabled and
+// holds its certificates per domain.
+func (f *CLBClient) AddListener(listener Listener) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if listener.Protocol == "" {
+		listener.Protocol = "HTTPS"
+	}
+
+	if listener.Domains == nil {
+		listener.Domains = map[string]string{}
+	}
+
+	if listener.DomainCAs == nil {
+		listener.DomainCAs = map[string]string{}
+	}
+
+	f.listeners[listenerKey(listener.LoadBalancerID, listener.ListenerID)] = &listener
+}
+
+// Listener returns a copy of the stored listener.
+func (f *CLBClient) Listener(loadBalancerID string, listenerID string) (Listener, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	listener, ok := f.listeners[listenerKey(loadBalancerID, listenerID)]
+	if !ok {
+		return Listener{}, false
+	}
+
+	copied := *listener
+	copied.Domains = map[string]string{}
+	for domain, certID := range listener.Domains {
+		copied.Domains[domain] = certID
+	}
+
+	copied.DomainCAs = map[string]string{}
+	for domain, certCaID := range listener.DomainCAs {
+		copied.DomainCAs[domain] = certCaID
+	}
+
+	return copied, true
+}
+
+// InjectError makes the next times calls of action fail with the given
+// Tencent error code, see SSLClient.InjectError.
+func (f *CLBClient) InjectError(action string, code string, message string, times int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errors[action] = &injectedError{
+		code:    code,
+		message: message,
+		times:   times,
+	}
+}
+
+func (f *CLBClient) ModifyListenerWithContext(ctx context.Context, request *clb.ModifyListenerRequest) (*clb.ModifyListenerResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("ModifyListener"); err != nil {
+		return nil, err
+	}
+
+	listener, err := f.lookup(request.LoadBalancerId, request.ListenerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Certificate != nil {
+		if len(listener.Domains) > 0 {
+			return nil, f.error("InvalidParameter", "certificates of an SNI enabled listener are set per domain")
+		}
+
+		if err := f.applyCertificate(request.Certificate, &listener.SSLMode, &listener.CertID, &listener.CertCaID); err != nil {
+			return nil, err
+		}
+	}
+
+	response := clb.NewModifyListenerResponse()
+	err = respond(response, f.ssl.RequestID(), map[string]interface{}{})
+
+	return response, err
+}
+
+func (f *CLBClient) ModifyDomainAttributesWithContext(ctx context.Context, request *clb.ModifyDomainAttributesRequest) (*clb.ModifyDomainAttributesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("ModifyDomainAttributes"); err != nil {
+		return nil, err
+	}
+
+	listener, err := f.lookup(request.LoadBalancerId, request.ListenerId)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := stringValue(request.Domain)
+	if _, ok := listener.Domains[domain]; !ok && !f.AutoCreate {
+		return nil, f.error("InvalidParameter", fmt.Sprintf("domain %s does not exist on listener %s", domain, listener.ListenerID))
+	}
+
+	if request.Certificate != nil {
+		var sslMode string
+		certID := listener.Domains[domain]
+		certCaID := listener.DomainCAs[domain]
+
+		if err := f.applyCertificate(request.Certificate, &sslMode, &certID, &certCaID); err != nil {
+			return nil, err
+		}
+
+		listener.Domains[domain] = certID
+		if sslMode == "MUTUAL" && certCaID != "" {
+			listener.DomainCAs[domain] = certCaID
+		} else if sslMode != "" {
+			delete(listener.DomainCAs, domain)
+		}
+	}
+
+	response := clb.NewModifyDomainAttributesResponse()
+	err = respond(response, f.ssl.RequestID(), map[string]interface{}{})
+
+	return response, err
+}
+
+func (f *CLBClient) DescribeListenersWithContext(ctx context.Context, request *clb.DescribeListenersRequest) (*clb.DescribeListenersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DescribeListeners"); err != nil {
+		return nil, err
+	}
+
+	loadBalancerID := stringValue(request.LoadBalancerId)
+	if loadBalancerID == "" {
+		return nil, f.error("MissingParameter", "LoadBalancerId is required")
+	}
+
+	var listenerIDs []string
+	for _, value := range request.ListenerIds {
+		listenerIDs = append(listenerIDs, stringValue(value))
+
+		if f.AutoCreate {
+			if _, err := f.lookup(request.LoadBalancerId, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var keys []string
+	for key, listener := range f.listeners {
+		if listener.LoadBalancerID != loadBalancerID {
+			continue
+		}
+
+		if len(listenerIDs) > 0 && !containsString(listenerIDs, listener.ListenerID) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var listeners []map[string]interface{}
+	for _, key := range keys {
+		listeners = append(listeners, listenerJSON(f.listeners[key]))
+	}
+
+	response := clb.NewDescribeListenersResponse()
+	err := respond(response, f.ssl.RequestID(), map[string]interface{}{
+		"TotalCount": len(listeners),
+		"Listeners":  listeners,
+	})
+
+	return response, err
+}
+
+func (f *CLBClient) applyCertificate(certificate *clb.CertificateInput, sslMode *string, certID *string, certCaID *string) error {
+	if certificate.CertId != nil {
+		if _, ok := f.ssl.Certificate(*certificate.CertId); !ok {
+			return f.error("InvalidParameter.CertificateNotFound", fmt.Sprintf("certificate %s does not exist", *certificate.CertId))
+		}
+
+		*certID = *certificate.CertId
+	}
+
+	if certificate.SSLMode != nil {
+		*sslMode = *certificate.SSLMode
+	}
+
+	if certificate.CertCaId != nil {
+		ca, ok := f.ssl.Certificate(*certificate.CertCaId)
+		if !ok || ca.CertificateType != "CA" {
+			return f.error("InvalidParameter.CertificateNotFound", fmt.Sprintf("ca certificate %s does not exist", *certificate.CertCaId))
+		}
+
+		*certCaID = *certificate.CertCaId
+	}
+
+	if *sslMode == "MUTUAL" && *certCaID == "" {
+		return f.error("InvalidParameter", "mutual authentication requires a ca certificate")
+	}
+
+	return nil
+}
+
+func (f *CLBClient) lookup(loadBalancerID *string, listenerID *string) (*Listener, error) {
+	if stringValue(loadBalancerID) == "" || stringValue(listenerID) == "" {
+		return nil, f.error("MissingParameter", "LoadBalancerId and ListenerId are required")
+	}
+
+	key := listenerKey(*loadBalancerID, *listenerID)
+
+	listener, ok := f.listeners[key]
+	if !ok {
+		if !f.AutoCreate {
+			return nil, f.error("InvalidParameter.ListenerIdNotFound", fmt.Sprintf("listener %s does not exist", key))
+		}
+
+		listener = &Listener{
+			LoadBalancerID: *loadBalancerID,
+			ListenerID:     *listenerID,
+			Protocol:       "HTTPS",
+			Domains:        map[string]string{},
+			DomainCAs:      map[string]string{},
+		}
+		f.listeners[key] = listener
+	}
+
+	return listener, nil
+}
+
+// error builds an SDK error with a request ID shared with the SSLClient, so
+// IDs stay unique across both APIs of a stand-in server.
+func (f *CLBClient) error(code string, message string) error {
+	return tencentCloudSDKError.NewTencentCloudSDKError(code, message, f.ssl.RequestID())
+}
+
+func (f *CLBClient) injected(action string) error {
+	injected, ok := f.errors[action]
+	if !ok {
+		return nil
+	}
+
+	if injected.times > 0 {
+		injected.times--
+		if injected.times == 0 {
+			delete(f.errors, action)
+		}
+	}
+
+	return f.error(injected.code, injected.message)
+}
+
+func listenerJSON(listener *Listener) map[string]interface{} {
+	result := map[string]interface{}{
+		"ListenerId": listener.ListenerID,
+		"Protocol":   listener.Protocol,
+	}
+
+	if len(listener.Domains) == 0 {
+		result["SniSwitch"] = 0
+		result["Certificate"] = certificateOutputJSON(listener.SSLMode, listener.CertID, listener.CertCaID)
+		return result
+	}
+
+	var domains []string
+	for domain := range listener.Domains {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var rules []map[string]interface{}
+	for _, domain := range domains {
+		rules = append(rules, map[string]interface{}{
+			"Domain":      domain,
+			"Url":         "/",
+			"Certificate": domainCertificateJSON(listener, domain),
+		})
+	}
+
+	result["SniSwitch"] = 1
+	result["Rules"] = rules
+
+	return result
+}
+
+func domainCertificateJSON(listener *Listener, domain string) map[string]interface{} {
+	if certCaID, ok := listener.DomainCAs[domain]; ok {
+		return certificateOutputJSON("MUTUAL", listener.Domains[domain], certCaID)
+	}
+
+	return certificateOutputJSON("UNIDIRECTIONAL", listener.Domains[domain], "")
+}
+
+func certificateOutputJSON(sslMode string, certID string, certCaID string) map[string]interface{} {
+	if sslMode == "" {
+		sslMode = "UNIDIRECTIONAL"
+	}
+
+	result := map[string]interface{}{
+		"SSLMode": sslMode,
+		"CertId":  certID,
+	}
+
+	if certCaID != "" {
+		result["CertCaId"] = certCaID
+	}
+
+	return result
+}
+
+func listenerKey(loadBalancerID string, listenerID string) string {
+	return strings.Join([]string{loadBalancerID, listenerID}, "/")
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
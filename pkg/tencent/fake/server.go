@@ -0,0 +1,262 @@
+package fake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/clb/v20180317"
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+const (
+	sslAPIVersion = "2019-12-05"
+	clbAPIVersion = "2018-03-17"
+
+	// signatures older than this are rejected, like the real API does
+	signatureMaxAge = 5 * time.Minute
+)
+
+type actionHandler func(ctx context.Context, body []byte) (interface{}, error)
+
+// Server serves the ssl.tencentcloudapi.com JSON API over HTTP, backed by an
+// SSLClient, and optionally the clb.tencentcloudapi.com listener API. Point a
+// client endpoint at it to run tendo against a local stand-in instead of
+// Tencent Cloud.
+type Server struct {
+	// Credentials maps secret IDs to secret keys. When empty, any well-formed
+	// TC3 signature is accepted without checking it.
+	Credentials map[string]string
+
+	ssl      *SSLClient
+	handlers map[string]map[string]actionHandler
+}
+
+func NewServer(ssl *SSLClient) *Server {
+	s := &Server{
+		Credentials: map[string]string{},
+		ssl:         ssl,
+		handlers:    map[string]map[string]actionHandler{},
+	}
+
+	s.handlers[sslAPIVersion] = map[string]actionHandler{
+		"DescribeCertificates":           handle(sslCertificate.NewDescribeCertificatesRequest, ssl.DescribeCertificatesWithContext),
+		"DescribeCertificateDetail":      handle(sslCertificate.NewDescribeCertificateDetailRequest, ssl.DescribeCertificateDetailWithContext),
+		"UploadCertificate":              handle(sslCertificate.NewUploadCertificateRequest, ssl.UploadCertificateWithContext),
+		"UpdateCertificateInstance":      handle(sslCertificate.NewUpdateCertificateInstanceRequest, ssl.UpdateCertificateInstanceWithContext),
+		"DescribeHostUpdateRecord":       handle(sslCertificate.NewDescribeHostUpdateRecordRequest, ssl.DescribeHostUpdateRecordWithContext),
+		"DeleteCertificate":              handle(sslCertificate.NewDeleteCertificateRequest, ssl.DeleteCertificateWithContext),
+		"ModifyCertificateAlias":         handle(sslCertificate.NewModifyCertificateAliasRequest, ssl.ModifyCertificateAliasWithContext),
+		"DeployCertificateInstance":      handle(sslCertificate.NewDeployCertificateInstanceRequest, ssl.DeployCertificateInstanceWithContext),
+		"DescribeHostDeployRecordDetail": handle(sslCertificate.NewDescribeHostDeployRecordDetailRequest, ssl.DescribeHostDeployRecordDetailWithContext),
+	}
+
+	return s
+}
+
+// ServeCLB serves the CLB listener API from clb as well. Actions are routed
+// by X-TC-Version, so both APIs share one endpoint.
+func (s *Server) ServeCLB(clbClient *CLBClient) {
+	s.handlers[clbAPIVersion] = map[string]actionHandler{
+		"ModifyListener":         handle(clb.NewModifyListenerRequest, clbClient.ModifyListenerWithContext),
+		"ModifyDomainAttributes": handle(clb.NewModifyDomainAttributesRequest, clbClient.ModifyDomainAttributesWithContext),
+		"DescribeListeners":      handle(clb.NewDescribeListenersRequest, clbClient.DescribeListenersWithContext),
+	}
+}
+
+// StartServer starts a stand-in server on a random local port. The caller
+// must Close it; its URL can be used as the client endpoint.
+func StartServer(ssl *SSLClient) (*Server, *httptest.Server) {
+	server := NewServer(ssl)
+
+	return server, httptest.NewServer(server)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := s.ssl.RequestID()
+
+	if r.Method != http.MethodPost {
+		writeError(w, requestID, "UnsupportedProtocol", fmt.Sprintf("HTTP method %s is not supported", r.Method))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, requestID, "InvalidParameter", fmt.Sprintf("unable to read request body with error: %s", err))
+		return
+	}
+
+	if err := s.verifySignature(r, body); err != nil {
+		var sdkError *tencentCloudSDKError.TencentCloudSDKError
+		if errors.As(err, &sdkError) {
+			writeError(w, requestID, sdkError.GetCode(), sdkError.GetMessage())
+			return
+		}
+
+		writeError(w, requestID, "AuthFailure", err.Error())
+		return
+	}
+
+	version := r.Header.Get("X-TC-Version")
+	action := r.Header.Get("X-TC-Action")
+
+	handler, ok := s.handlers[version][action]
+	if !ok {
+		writeError(w, requestID, "InvalidAction", fmt.Sprintf("action %s of version %s is not supported", action, version))
+		return
+	}
+
+	response, err := handler(r.Context(), body)
+	if err != nil {
+		var sdkError *tencentCloudSDKError.TencentCloudSDKError
+		if errors.As(err, &sdkError) {
+			if sdkError.GetRequestId() != "" {
+				requestID = sdkError.GetRequestId()
+			}
+
+			writeError(w, requestID, sdkError.GetCode(), sdkError.GetMessage())
+			return
+		}
+
+		writeError(w, requestID, "InternalError", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// verifySignature checks the TC3-HMAC-SHA256 Authorization header.
+func (s *Server) verifySignature(r *http.Request, body []byte) error {
+	authorization := r.Header.Get("Authorization")
+
+	algorithm, fields, found := strings.Cut(authorization, " ")
+	if !found || algorithm != "TC3-HMAC-SHA256" {
+		return authError("AuthFailure.SignatureFailure", "only TC3-HMAC-SHA256 signatures are supported")
+	}
+
+	params := map[string]string{}
+	for _, field := range strings.Split(fields, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		params[key] = value
+	}
+
+	// Credential=<secret id>/<date>/<service>/tc3_request
+	credential := strings.Split(params["Credential"], "/")
+	if len(credential) != 4 || credential[3] != "tc3_request" {
+		return authError("AuthFailure.SignatureFailure", "malformed credential in Authorization header")
+	}
+	secretID, date, service := credential[0], credential[1], credential[2]
+
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+	if err != nil {
+		return authError("AuthFailure.SignatureFailure", "X-TC-Timestamp is missing or invalid")
+	}
+
+	requestTime := time.Unix(timestamp, 0).UTC()
+	if requestTime.Format("2006-01-02") != date {
+		return authError("AuthFailure.SignatureFailure", "credential date does not match X-TC-Timestamp")
+	}
+
+	if age := time.Since(requestTime); age > signatureMaxAge || age < -signatureMaxAge {
+		return authError("AuthFailure.SignatureExpire", "signature has expired")
+	}
+
+	if len(s.Credentials) == 0 {
+		return nil
+	}
+
+	secretKey, ok := s.Credentials[secretID]
+	if !ok {
+		return authError("AuthFailure.SecretIdNotFound", fmt.Sprintf("secret id %s does not exist", secretID))
+	}
+
+	signedHeaders := params["SignedHeaders"]
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+
+		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", name, strings.ToLower(strings.TrimSpace(value))))
+	}
+
+	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
+		r.Method,
+		"/",
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	)
+
+	credentialScope := fmt.Sprintf("%s/%s/tc3_request", date, service)
+	stringToSign := fmt.Sprintf("TC3-HMAC-SHA256\n%d\n%s\n%s", timestamp, credentialScope, sha256Hex([]byte(canonicalRequest)))
+
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	if !hmac.Equal([]byte(signature), []byte(params["Signature"])) {
+		return authError("AuthFailure.SignatureFailure", "signature does not match")
+	}
+
+	return nil
+}
+
+// handle adapts a typed SDK call to an actionHandler that decodes the JSON
+// request body with the SDK request type.
+func handle[Req interface{ FromJsonString(string) error }, Resp any](newRequest func() Req, call func(context.Context, Req) (Resp, error)) actionHandler {
+	return func(ctx context.Context, body []byte) (interface{}, error) {
+		request := newRequest()
+		if len(body) > 0 {
+			if err := request.FromJsonString(string(body)); err != nil {
+				return nil, tencentCloudSDKError.NewTencentCloudSDKError("InvalidParameter", err.Error(), "")
+			}
+		}
+
+		return call(ctx, request)
+	}
+}
+
+func writeError(w http.ResponseWriter, requestID string, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Response": map[string]interface{}{
+			"Error": map[string]string{
+				"Code":    code,
+				"Message": message,
+			},
+			"RequestId": requestID,
+		},
+	})
+}
+
+func authError(code string, message string) error {
+	return tencentCloudSDKError.NewTencentCloudSDKError(code, message, "")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,182 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+	"go.uber.org/zap"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+func TestMain(m *testing.M) {
+	// main configures the logger from config.yaml, tests have none
+	logger.Logger = zap.NewNop()
+
+	os.Exit(m.Run())
+}
+
+const (
+	testSecretID  = "AKIDtendotest"
+	testSecretKey = "tendo-test-secret"
+)
+
+// newServer starts a stand-in accepting only the test credentials.
+func newServer(t *testing.T) (*fake.SSLClient, string) {
+	t.Helper()
+
+	ssl := fake.NewSSLClient()
+	server, httpServer := fake.StartServer(ssl)
+	server.Credentials[testSecretID] = testSecretKey
+	t.Cleanup(httpServer.Close)
+
+	return ssl, httpServer.URL
+}
+
+// newClient builds the SDK client of a target pointed at endpoint, the same
+// way the watcher builds it from the tencent.endpoint setting.
+func newClient(t *testing.T, endpoint string, secretID string, secretKey string) tencent.SSLClient {
+	t.Helper()
+
+	target := &tencent.TencentSSLCertificate{
+		Context:     context.Background(),
+		Credentials: common.NewCredential(secretID, secretKey),
+		Region:      "ap-singapore",
+		ClientOptions: tencent.ClientOptions{
+			Endpoint: endpoint,
+		},
+	}
+
+	client, err := target.BuildClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func errorCode(err error) string {
+	var sdkError *tencentCloudSDKError.TencentCloudSDKError
+	if !errors.As(err, &sdkError) {
+		return ""
+	}
+
+	return sdkError.GetCode()
+}
+
+func TestServerVerifiesSignature(t *testing.T) {
+	_, endpoint := newServer(t)
+
+	tests := []struct {
+		name      string
+		secretID  string
+		secretKey string
+		code      string
+	}{
+		{
+			name:      "valid credentials",
+			secretID:  testSecretID,
+			secretKey: testSecretKey,
+		},
+		{
+			name:      "wrong secret key",
+			secretID:  testSecretID,
+			secretKey: "not-the-secret",
+			code:      "AuthFailure.SignatureFailure",
+		},
+		{
+			name:      "unknown secret id",
+			secretID:  "AKIDunknown",
+			secretKey: testSecretKey,
+			code:      "AuthFailure.SecretIdNotFound",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newClient(t, endpoint, test.secretID, test.secretKey)
+
+			_, err := client.DescribeCertificatesWithContext(context.Background(), sslCertificate.NewDescribeCertificatesRequest())
+
+			if code := errorCode(err); code != test.code {
+				t.Errorf("got error %v, want code %q", err, test.code)
+			}
+		})
+	}
+}
+
+func TestServerDeploySteps(t *testing.T) {
+	ssl, endpoint := newServer(t)
+	client := newClient(t, endpoint, testSecretID, testSecretKey)
+	ctx := context.Background()
+
+	upload := sslCertificate.NewUploadCertificateRequest()
+	upload.CertificatePublicKey = common.StringPtr("old certificate")
+	upload.Alias = common.StringPtr("app")
+
+	uploaded, err := client.UploadCertificateWithContext(ctx, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCertID := *uploaded.Response.CertificateId
+
+	ssl.SetDeploySteps(fake.DeployStatusPending, fake.DeployStatusDeploying, fake.DeployStatusSuccess)
+
+	update := sslCertificate.NewUpdateCertificateInstanceRequest()
+	update.OldCertificateId = common.StringPtr(oldCertID)
+	update.CertificatePublicKey = common.StringPtr("new certificate")
+	update.ResourceTypes = common.StringPtrs([]string{"cdn"})
+
+	_, err = client.UpdateCertificateInstanceWithContext(ctx, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every read reports the record and moves it one step further
+	for _, want := range []uint64{fake.DeployStatusPending, fake.DeployStatusDeploying, fake.DeployStatusSuccess, fake.DeployStatusSuccess} {
+		request := sslCertificate.NewDescribeHostUpdateRecordRequest()
+		request.OldCertificateId = common.StringPtr(oldCertID)
+
+		response, err := client.DescribeHostUpdateRecordWithContext(ctx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records := response.Response.DeployRecordList
+		if len(records) != 1 || records[0].Status == nil {
+			t.Fatalf("got %d deploy records, want 1", len(records))
+		}
+
+		if *records[0].Status != want {
+			t.Fatalf("got deploy status %d, want %d", *records[0].Status, want)
+		}
+	}
+}
+
+func TestServerInjectError(t *testing.T) {
+	ssl, endpoint := newServer(t)
+	client := newClient(t, endpoint, testSecretID, testSecretKey)
+	ctx := context.Background()
+
+	ssl.InjectError("DescribeCertificates", "RequestLimitExceeded", "too many requests", 2)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		_, err := client.DescribeCertificatesWithContext(ctx, sslCertificate.NewDescribeCertificatesRequest())
+
+		want := "RequestLimitExceeded"
+		if attempt > 2 {
+			want = ""
+		}
+
+		if code := errorCode(err); code != want {
+			t.Errorf("attempt %d got error %v, want code %q", attempt, err, want)
+		}
+	}
+}
@@ -0,0 +1,1028 @@
+// Package fake provides an in-memory implementation of tencent.SSLClient.
+// It keeps uploaded certificates and deploy records so code built on top of
+// pkg/tencent can be exercised without a Tencent Cloud account.
+package fake
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Certificate statuses as reported by DescribeCertificates.
+const (
+	CertificateStatusPending uint64 = 0
+	CertificateStatusIssued  uint64 = 1
+)
+
+// Deploy record statuses as reported by DescribeHostUpdateRecord.
+const (
+	DeployStatusPending           uint64 = 0
+	DeployStatusSuccess           uint64 = 1
+	DeployStatusFailed            uint64 = 2
+	DeployStatusDeploying         uint64 = 3
+	DeployStatusRollbackSucceeded uint64 = 4
+	DeployStatusRollbackFailed    uint64 = 5
+)
+
+type Certificate struct {
+	CertificateID   string
+	Alias           string
+	CertificateType string
+	PublicKey       string
+	PrivateKey      string
+	Status          uint64
+	Domain          string
+	SubjectAltName  []string
+	Tags            map[string]string
+	CertBeginTime   time.Time
+	CertEndTime     time.Time
+	InsertTime      time.Time
+
+	// EncryptCert and EncryptPrivateKey hold the encryption key pair of
+	// SM2 certificates.
+	EncryptCert       string
+	EncryptPrivateKey string
+}
+
+type DeployRecord struct {
+	ID            uint64
+	CertID        string
+	OldCertID     string
+	ResourceTypes []string
+	Regions       []string
+	Status        uint64
+	CreateTime    time.Time
+	UpdateTime    time.Time
+
+	steps []uint64
+}
+
+// InstanceDeployRecord is a DeployCertificateInstance deployment, with one
+// detail per instance.
+type InstanceDeployRecord struct {
+	ID           uint64
+	CertID       string
+	ResourceType string
+	Details      []InstanceDeployDetail
+	CreateTime   time.Time
+}
+
+type InstanceDeployDetail struct {
+	ID         uint64
+	InstanceID string
+	OldCertID  string
+	Status     uint64
+	ErrorMsg   string
+
+	steps []uint64
+}
+
+type injectedError struct {
+	code    string
+	message string
+	times   int
+}
+
+// SSLClient is a fake Tencent SSL API. It is safe for concurrent use.
+type SSLClient struct {
+	mu           sync.Mutex
+	certificates map[string]*Certificate
+	order        []string
+	records      []*DeployRecord
+	instances    []*InstanceDeployRecord
+	bindings     map[string]string
+	failing      map[string]string
+	certSequence int
+	recordSeq    uint64
+	requestSeq   int
+	deploySteps  []uint64
+	errors       map[string]*injectedError
+}
+
+func NewSSLClient() *SSLClient {
+	return &SSLClient{
+		certificates: map[string]*Certificate{},
+		bindings:     map[string]string{},
+		failing:      map[string]string{},
+		errors:       map[string]*injectedError{},
+	}
+}
+
+// SetDeploySteps sets the statuses a new deploy record goes through. Every
+// DescribeHostUpdateRecord or DescribeHostDeployRecordDetail call that
+// reports the record moves it one step further. Without steps records are
+// created as succeeded.
+func (f *SSLClient) SetDeploySteps(steps ...uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deploySteps = steps
+}
+
+// InjectError makes the next times calls of action fail with the given
+// Tencent error code. A times of zero or less fails every call until
+// ClearErrors is called.
+func (f *SSLClient) InjectError(action string, code string, message string, times int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errors[action] = &injectedError{
+		code:    code,
+		message: message,
+		times:   times,
+	}
+}
+
+// FailInstance makes every deployment to the instance fail with message.
+func (f *SSLClient) FailInstance(resourceType string, instanceID string, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failing[instanceKey(resourceType, instanceID)] = message
+}
+
+// BindInstance binds a certificate to an instance as if it had been deployed
+// there before.
+func (f *SSLClient) BindInstance(resourceType string, instanceID string, certID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.bindings[instanceKey(resourceType, instanceID)] = certID
+}
+
+// InstanceCertificate returns the ID of the certificate deployed to the
+// instance.
+func (f *SSLClient) InstanceCertificate(resourceType string, instanceID string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	certID, ok := f.bindings[instanceKey(resourceType, instanceID)]
+	return certID, ok
+}
+
+// InstanceDeployRecords returns copies of all instance deployments in
+// creation order.
+func (f *SSLClient) InstanceDeployRecords() []InstanceDeployRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var records []InstanceDeployRecord
+	for _, record := range f.instances {
+		copied := *record
+		copied.Details = append([]InstanceDeployDetail{}, record.Details...)
+		records = append(records, copied)
+	}
+
+	return records
+}
+
+func (f *SSLClient) ClearErrors() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errors = map[string]*injectedError{}
+}
+
+// AddCertificate stores a certificate as if it had been uploaded and returns
+// its ID. An empty CertificateID gets a generated one.
+func (f *SSLClient) AddCertificate(cert Certificate) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.addCertificate(cert)
+}
+
+// Certificate returns a copy of the stored certificate with the given ID.
+func (f *SSLClient) Certificate(certID string) (Certificate, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cert, ok := f.certificates[certID]
+	if !ok {
+		return Certificate{}, false
+	}
+
+	return *cert, true
+}
+
+// Certificates returns copies of all stored certificates in upload order.
+func (f *SSLClient) Certificates() []Certificate {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var certs []Certificate
+	for _, id := range f.order {
+		certs = append(certs, *f.certificates[id])
+	}
+
+	return certs
+}
+
+// DeployRecords returns copies of all deploy records in creation order.
+func (f *SSLClient) DeployRecords() []DeployRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var records []DeployRecord
+	for _, record := range f.records {
+		records = append(records, *record)
+	}
+
+	return records
+}
+
+// SetDeployRecordStatus changes the status of a deploy record, e.g. to
+// simulate a failed deployment.
+func (f *SSLClient) SetDeployRecordStatus(recordID uint64, status uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, record := range f.records {
+		if record.ID == recordID {
+			record.Status = status
+			record.UpdateTime = time.Now()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("deploy record %d not found", recordID)
+}
+
+func (f *SSLClient) DescribeCertificatesWithContext(ctx context.Context, request *sslCertificate.DescribeCertificatesRequest) (*sslCertificate.DescribeCertificatesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DescribeCertificates"); err != nil {
+		return nil, err
+	}
+
+	var matched []*Certificate
+	for _, id := range f.order {
+		cert := f.certificates[id]
+
+		if request.SearchKey != nil && *request.SearchKey != "" {
+			key := *request.SearchKey
+			if !strings.Contains(cert.Alias, key) && !strings.Contains(cert.Domain, key) && cert.CertificateID != key {
+				continue
+			}
+		}
+
+		if request.CertificateType != nil && *request.CertificateType != "" && *request.CertificateType != cert.CertificateType {
+			continue
+		}
+
+		if len(request.CertificateStatus) > 0 && !containsStatus(request.CertificateStatus, cert.Status) {
+			continue
+		}
+
+		if !hasTags(cert, request.Tags) {
+			continue
+		}
+
+		matched = append(matched, cert)
+	}
+
+	offset := uint64(0)
+	if request.Offset != nil {
+		offset = *request.Offset
+	}
+
+	limit := uint64(20)
+	if request.Limit != nil {
+		limit = *request.Limit
+	}
+
+	var certificates []map[string]interface{}
+	for i := offset; i < uint64(len(matched)) && i < offset+limit; i++ {
+		item := certificateJSON(matched[i])
+		item["BoundResource"] = f.boundResources(matched[i].CertificateID)
+		certificates = append(certificates, item)
+	}
+
+	response := sslCertificate.NewDescribeCertificatesResponse()
+	err := f.respond(response, map[string]interface{}{
+		"TotalCount":   len(matched),
+		"Certificates": certificates,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) DescribeCertificateDetailWithContext(ctx context.Context, request *sslCertificate.DescribeCertificateDetailRequest) (*sslCertificate.DescribeCertificateDetailResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DescribeCertificateDetail"); err != nil {
+		return nil, err
+	}
+
+	cert, err := f.lookup(request.CertificateId)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := certificateJSON(cert)
+	detail["CertificatePublicKey"] = cert.PublicKey
+	detail["CertificatePrivateKey"] = cert.PrivateKey
+
+	if cert.EncryptCert != "" {
+		detail["EncryptAlgorithm"] = "SM2"
+		detail["EncryptCert"] = cert.EncryptCert
+		detail["EncryptPrivateKey"] = cert.EncryptPrivateKey
+	}
+
+	response := sslCertificate.NewDescribeCertificateDetailResponse()
+	err = f.respond(response, detail)
+
+	return response, err
+}
+
+func (f *SSLClient) UploadCertificateWithContext(ctx context.Context, request *sslCertificate.UploadCertificateRequest) (*sslCertificate.UploadCertificateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("UploadCertificate"); err != nil {
+		return nil, err
+	}
+
+	if request.CertificatePublicKey == nil || *request.CertificatePublicKey == "" {
+		return nil, f.error("MissingParameter", "CertificatePublicKey is required")
+	}
+
+	certType := "SVR"
+	if request.CertificateType != nil && *request.CertificateType != "" {
+		certType = *request.CertificateType
+	}
+
+	repeatable := request.Repeatable != nil && *request.Repeatable
+	if !repeatable {
+		for _, id := range f.order {
+			if f.certificates[id].PublicKey == *request.CertificatePublicKey {
+				response := sslCertificate.NewUploadCertificateResponse()
+				err := f.respond(response, map[string]interface{}{
+					"CertificateId": id,
+					"RepeatCertId":  id,
+				})
+
+				return response, err
+			}
+		}
+	}
+
+	id := f.addCertificate(Certificate{
+		Alias:             stringValue(request.Alias),
+		CertificateType:   certType,
+		PublicKey:         *request.CertificatePublicKey,
+		PrivateKey:        stringValue(request.CertificatePrivateKey),
+		EncryptCert:       stringValue(request.EncryptCert),
+		EncryptPrivateKey: stringValue(request.EncryptPrivateKey),
+		Tags:              tagMap(request.Tags),
+	})
+
+	response := sslCertificate.NewUploadCertificateResponse()
+	err := f.respond(response, map[string]interface{}{
+		"CertificateId": id,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) UpdateCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.UpdateCertificateInstanceRequest) (*sslCertificate.UpdateCertificateInstanceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("UpdateCertificateInstance"); err != nil {
+		return nil, err
+	}
+
+	oldCert, err := f.lookup(request.OldCertificateId)
+	if err != nil {
+		return nil, err
+	}
+
+	// a new public key means the certificate is uploaded as part of the update,
+	// otherwise CertificateId names an existing certificate to deploy
+	var certID string
+	if request.CertificatePublicKey != nil && *request.CertificatePublicKey != "" {
+		tags := tagMap(request.Tags)
+		if len(tags) == 0 {
+			tags = oldCert.Tags
+		}
+
+		certID = f.addCertificate(Certificate{
+			Alias:             oldCert.Alias,
+			CertificateType:   oldCert.CertificateType,
+			PublicKey:         *request.CertificatePublicKey,
+			PrivateKey:        stringValue(request.CertificatePrivateKey),
+			EncryptCert:       stringValue(request.EncryptCert),
+			EncryptPrivateKey: stringValue(request.EncryptPrivateKey),
+			Tags:              tags,
+		})
+	} else {
+		cert, err := f.lookup(request.CertificateId)
+		if err != nil {
+			return nil, err
+		}
+
+		certID = cert.CertificateID
+	}
+
+	var resourceTypes []string
+	var regions []string
+	for _, value := range request.ResourceTypes {
+		resourceTypes = append(resourceTypes, *value)
+	}
+	for _, value := range request.ResourceTypesRegions {
+		for _, region := range value.Regions {
+			regions = appendUnique(regions, *region)
+		}
+	}
+
+	f.recordSeq++
+	now := time.Now()
+	record := &DeployRecord{
+		ID:            f.recordSeq,
+		CertID:        certID,
+		OldCertID:     oldCert.CertificateID,
+		ResourceTypes: resourceTypes,
+		Regions:       regions,
+		Status:        DeployStatusSuccess,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	if len(f.deploySteps) > 0 {
+		record.Status = f.deploySteps[0]
+		record.steps = append([]uint64{}, f.deploySteps[1:]...)
+	}
+	f.records = append(f.records, record)
+
+	response := sslCertificate.NewUpdateCertificateInstanceResponse()
+	err = f.respond(response, map[string]interface{}{
+		"DeployRecordId": record.ID,
+		"DeployStatus":   1,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) DescribeHostUpdateRecordWithContext(ctx context.Context, request *sslCertificate.DescribeHostUpdateRecordRequest) (*sslCertificate.DescribeHostUpdateRecordResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DescribeHostUpdateRecord"); err != nil {
+		return nil, err
+	}
+
+	var matched []*DeployRecord
+	for _, record := range f.records {
+		if request.CertificateId != nil && *request.CertificateId != "" && *request.CertificateId != record.CertID {
+			continue
+		}
+
+		if request.OldCertificateId != nil && *request.OldCertificateId != "" && *request.OldCertificateId != record.OldCertID {
+			continue
+		}
+
+		matched = append(matched, record)
+	}
+
+	// newest records first, like the real API
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].ID > matched[j].ID
+	})
+
+	offset := uint64(0)
+	if request.Offset != nil {
+		offset = *request.Offset
+	}
+
+	limit := uint64(10)
+	if request.Limit != nil {
+		limit = *request.Limit
+	}
+
+	var records []map[string]interface{}
+	for i := offset; i < uint64(len(matched)) && i < offset+limit; i++ {
+		records = append(records, deployRecordJSON(matched[i]))
+		matched[i].advance()
+	}
+
+	response := sslCertificate.NewDescribeHostUpdateRecordResponse()
+	err := f.respond(response, map[string]interface{}{
+		"TotalCount":       len(matched),
+		"DeployRecordList": records,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) DeleteCertificateWithContext(ctx context.Context, request *sslCertificate.DeleteCertificateRequest) (*sslCertificate.DeleteCertificateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DeleteCertificate"); err != nil {
+		return nil, err
+	}
+
+	cert, err := f.lookup(request.CertificateId)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, certID := range f.bindings {
+		if certID == cert.CertificateID {
+			return nil, f.error("FailedOperation", fmt.Sprintf("certificate %s is deployed to %s", cert.CertificateID, key))
+		}
+	}
+
+	delete(f.certificates, cert.CertificateID)
+	for i, id := range f.order {
+		if id == cert.CertificateID {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+
+	response := sslCertificate.NewDeleteCertificateResponse()
+	err = f.respond(response, map[string]interface{}{
+		"DeleteResult": true,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) ModifyCertificateAliasWithContext(ctx context.Context, request *sslCertificate.ModifyCertificateAliasRequest) (*sslCertificate.ModifyCertificateAliasResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("ModifyCertificateAlias"); err != nil {
+		return nil, err
+	}
+
+	cert, err := f.lookup(request.CertificateId)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Alias = stringValue(request.Alias)
+
+	response := sslCertificate.NewModifyCertificateAliasResponse()
+	err = f.respond(response, map[string]interface{}{
+		"CertificateId": cert.CertificateID,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) DeployCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.DeployCertificateInstanceRequest) (*sslCertificate.DeployCertificateInstanceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DeployCertificateInstance"); err != nil {
+		return nil, err
+	}
+
+	cert, err := f.lookup(request.CertificateId)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceType := stringValue(request.ResourceType)
+	if resourceType == "" {
+		return nil, f.error("MissingParameter", "ResourceType is required")
+	}
+
+	if len(request.InstanceIdList) == 0 {
+		return nil, f.error("MissingParameter", "InstanceIdList is required")
+	}
+
+	f.recordSeq++
+	record := &InstanceDeployRecord{
+		ID:           f.recordSeq,
+		CertID:       cert.CertificateID,
+		ResourceType: resourceType,
+		CreateTime:   time.Now(),
+	}
+
+	for i, value := range request.InstanceIdList {
+		instanceID := stringValue(value)
+		detail := InstanceDeployDetail{
+			ID:         uint64(i + 1),
+			InstanceID: instanceID,
+			OldCertID:  f.bindings[instanceKey(resourceType, instanceID)],
+			Status:     DeployStatusSuccess,
+		}
+		if len(f.deploySteps) > 0 {
+			detail.Status = f.deploySteps[0]
+			detail.steps = append([]uint64{}, f.deploySteps[1:]...)
+		}
+
+		record.Details = append(record.Details, detail)
+	}
+
+	f.settle(record)
+	f.instances = append(f.instances, record)
+
+	response := sslCertificate.NewDeployCertificateInstanceResponse()
+	err = f.respond(response, map[string]interface{}{
+		"DeployRecordId": record.ID,
+		"DeployStatus":   1,
+	})
+
+	return response, err
+}
+
+func (f *SSLClient) DescribeHostDeployRecordDetailWithContext(ctx context.Context, request *sslCertificate.DescribeHostDeployRecordDetailRequest) (*sslCertificate.DescribeHostDeployRecordDetailResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.injected("DescribeHostDeployRecordDetail"); err != nil {
+		return nil, err
+	}
+
+	recordID, err := strconv.ParseUint(stringValue(request.DeployRecordId), 10, 64)
+	if err != nil {
+		return nil, f.error("InvalidParameter", "DeployRecordId is invalid")
+	}
+
+	var record *InstanceDeployRecord
+	for _, value := range f.instances {
+		if value.ID == recordID {
+			record = value
+		}
+	}
+	if record == nil {
+		return nil, f.error("FailedOperation", fmt.Sprintf("deploy record %d does not exist", recordID))
+	}
+
+	offset := uint64(0)
+	if request.Offset != nil {
+		offset = *request.Offset
+	}
+
+	limit := uint64(10)
+	if request.Limit != nil {
+		limit = *request.Limit
+	}
+
+	var success, failed, running int
+	var details []map[string]interface{}
+	for i, detail := range record.Details {
+		switch detail.Status {
+		case DeployStatusSuccess:
+			success++
+		case DeployStatusFailed:
+			failed++
+		default:
+			running++
+		}
+
+		if uint64(i) >= offset && uint64(i) < offset+limit {
+			details = append(details, instanceDeployDetailJSON(record, detail))
+		}
+	}
+
+	for i := range record.Details {
+		record.Details[i].advance()
+	}
+	f.settle(record)
+
+	response := sslCertificate.NewDescribeHostDeployRecordDetailResponse()
+	err = f.respond(response, map[string]interface{}{
+		"TotalCount":             len(record.Details),
+		"DeployRecordDetailList": details,
+		"SuccessTotalCount":      success,
+		"FailedTotalCount":       failed,
+		"RunningTotalCount":      running,
+	})
+
+	return response, err
+}
+
+// settle fails details of failing instances once they finish deploying and
+// binds the certificate to instances that succeeded.
+func (f *SSLClient) settle(record *InstanceDeployRecord) {
+	for i := range record.Details {
+		detail := &record.Details[i]
+		key := instanceKey(record.ResourceType, detail.InstanceID)
+
+		if message, ok := f.failing[key]; ok && detail.Status == DeployStatusSuccess {
+			detail.Status = DeployStatusFailed
+			detail.ErrorMsg = message
+			detail.steps = nil
+		}
+
+		if detail.Status == DeployStatusSuccess {
+			f.bindings[key] = record.CertID
+		}
+	}
+}
+
+func (f *SSLClient) addCertificate(cert Certificate) string {
+	if cert.CertificateID == "" {
+		f.certSequence++
+		cert.CertificateID = fmt.Sprintf("fake%04d", f.certSequence)
+	}
+
+	if cert.CertificateType == "" {
+		cert.CertificateType = "SVR"
+	}
+
+	if cert.InsertTime.IsZero() {
+		cert.InsertTime = time.Now()
+	}
+
+	if cert.Status == CertificateStatusPending {
+		cert.Status = CertificateStatusIssued
+	}
+
+	fillFromPEM(&cert)
+
+	if _, ok := f.certificates[cert.CertificateID]; !ok {
+		f.order = append(f.order, cert.CertificateID)
+	}
+	f.certificates[cert.CertificateID] = &cert
+
+	return cert.CertificateID
+}
+
+func (f *SSLClient) lookup(certID *string) (*Certificate, error) {
+	if certID == nil || *certID == "" {
+		return nil, f.error("MissingParameter", "CertificateId is required")
+	}
+
+	cert, ok := f.certificates[*certID]
+	if !ok {
+		return nil, f.error("FailedOperation.CertificateNotFound", fmt.Sprintf("certificate %s does not exist", *certID))
+	}
+
+	return cert, nil
+}
+
+// injected returns the error injected for action, if any, and counts it.
+func (f *SSLClient) injected(action string) error {
+	injected, ok := f.errors[action]
+	if !ok {
+		return nil
+	}
+
+	if injected.times > 0 {
+		injected.times--
+		if injected.times == 0 {
+			delete(f.errors, action)
+		}
+	}
+
+	return f.error(injected.code, injected.message)
+}
+
+// RequestID returns a new request ID in the format used by the fake.
+func (f *SSLClient) RequestID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.nextRequestID()
+}
+
+func (f *SSLClient) nextRequestID() string {
+	f.requestSeq++
+	return fmt.Sprintf("fake-request-%d", f.requestSeq)
+}
+
+func (f *SSLClient) error(code string, message string) error {
+	return tencentCloudSDKError.NewTencentCloudSDKError(code, message, f.nextRequestID())
+}
+
+func (f *SSLClient) respond(response interface{ FromJsonString(string) error }, params map[string]interface{}) error {
+	return respond(response, f.nextRequestID(), params)
+}
+
+// respond fills an SDK response from a plain map, the same way the SDK
+// decodes a real API response.
+func respond(response interface{ FromJsonString(string) error }, requestID string, params map[string]interface{}) error {
+	params["RequestId"] = requestID
+
+	body, err := json.Marshal(map[string]interface{}{
+		"Response": params,
+	})
+	if err != nil {
+		return err
+	}
+
+	return response.FromJsonString(string(body))
+}
+
+func (record *DeployRecord) advance() {
+	if len(record.steps) == 0 {
+		return
+	}
+
+	record.Status = record.steps[0]
+	record.steps = record.steps[1:]
+	record.UpdateTime = time.Now()
+}
+
+func (detail *InstanceDeployDetail) advance() {
+	if len(detail.steps) == 0 {
+		return
+	}
+
+	detail.Status = detail.steps[0]
+	detail.steps = detail.steps[1:]
+}
+
+func certificateJSON(cert *Certificate) map[string]interface{} {
+	result := map[string]interface{}{
+		"CertificateId":   cert.CertificateID,
+		"Alias":           cert.Alias,
+		"CertificateType": cert.CertificateType,
+		"Status":          cert.Status,
+		"Domain":          cert.Domain,
+		"SubjectAltName":  cert.SubjectAltName,
+		"InsertTime":      cert.InsertTime.Format(timeLayout),
+	}
+
+	var tags []map[string]string
+	for key, value := range cert.Tags {
+		tags = append(tags, map[string]string{
+			"TagKey":   key,
+			"TagValue": value,
+		})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i]["TagKey"] < tags[j]["TagKey"]
+	})
+	result["Tags"] = tags
+
+	if !cert.CertBeginTime.IsZero() {
+		result["CertBeginTime"] = cert.CertBeginTime.Format(timeLayout)
+	}
+
+	if !cert.CertEndTime.IsZero() {
+		result["CertEndTime"] = cert.CertEndTime.Format(timeLayout)
+	}
+
+	return result
+}
+
+func deployRecordJSON(record *DeployRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":            record.ID,
+		"CertId":        record.CertID,
+		"OldCertId":     record.OldCertID,
+		"ResourceTypes": record.ResourceTypes,
+		"Regions":       record.Regions,
+		"Status":        record.Status,
+		"CreateTime":    record.CreateTime.Format(timeLayout),
+		"UpdateTime":    record.UpdateTime.Format(timeLayout),
+	}
+}
+
+func instanceDeployDetailJSON(record *InstanceDeployRecord, detail InstanceDeployDetail) map[string]interface{} {
+	result := map[string]interface{}{
+		"Id":         detail.ID,
+		"CertId":     record.CertID,
+		"OldCertId":  detail.OldCertID,
+		"InstanceId": detail.InstanceID,
+		"Status":     detail.Status,
+		"ErrorMsg":   detail.ErrorMsg,
+		"CreateTime": record.CreateTime.Format(timeLayout),
+	}
+
+	// clb instances are "<loadBalancerId>|<listenerId>[|<domain>]"
+	if record.ResourceType == "clb" {
+		parts := strings.Split(detail.InstanceID, "|")
+		result["InstanceId"] = parts[0]
+		if len(parts) > 1 {
+			result["ListenerId"] = parts[1]
+		}
+		if len(parts) > 2 {
+			result["Domains"] = parts[2:]
+		}
+	}
+
+	return result
+}
+
+// boundResources returns the resource types of the instances the
+// certificate is deployed to.
+func (f *SSLClient) boundResources(certID string) []string {
+	seen := map[string]bool{}
+	resourceTypes := []string{}
+	for key, boundID := range f.bindings {
+		resourceType, _, _ := strings.Cut(key, "/")
+		if boundID == certID && !seen[resourceType] {
+			seen[resourceType] = true
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+	}
+	sort.Strings(resourceTypes)
+
+	return resourceTypes
+}
+
+func instanceKey(resourceType string, instanceID string) string {
+	return resourceType + "/" + instanceID
+}
+
+// fillFromPEM sets domain and validity from the leaf certificate when the
+// public key is a parseable PEM certificate.
+func fillFromPEM(cert *Certificate) {
+	block, _ := pem.Decode([]byte(cert.PublicKey))
+	if block == nil {
+		return
+	}
+
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return
+	}
+
+	if cert.Domain == "" {
+		cert.Domain = leaf.Subject.CommonName
+		if cert.Domain == "" && len(leaf.DNSNames) > 0 {
+			cert.Domain = leaf.DNSNames[0]
+		}
+	}
+
+	if len(cert.SubjectAltName) == 0 {
+		cert.SubjectAltName = leaf.DNSNames
+	}
+
+	if cert.CertBeginTime.IsZero() {
+		cert.CertBeginTime = leaf.NotBefore
+	}
+
+	if cert.CertEndTime.IsZero() {
+		cert.CertEndTime = leaf.NotAfter
+	}
+}
+
+func hasTags(cert *Certificate, tags []*sslCertificate.Tags) bool {
+	for _, tag := range tags {
+		if tag == nil || tag.TagKey == nil {
+			continue
+		}
+
+		value, ok := cert.Tags[*tag.TagKey]
+		if !ok || (tag.TagValue != nil && *tag.TagValue != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func tagMap(tags []*sslCertificate.Tags) map[string]string {
+	result := map[string]string{}
+	for _, tag := range tags {
+		if tag == nil || tag.TagKey == nil {
+			continue
+		}
+
+		result[*tag.TagKey] = stringValue(tag.TagValue)
+	}
+
+	return result
+}
+
+func containsStatus(statuses []*uint64, status uint64) bool {
+	for _, value := range statuses {
+		if value != nil && *value == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, item := range values {
+		if item == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,125 @@
+package tencent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// CertificateFingerprint identifies a leaf certificate without relying on
+// the exact PEM text, which Tencent Cloud may normalize.
+type CertificateFingerprint struct {
+	SHA256    string
+	Serial    string
+	PublicKey []byte
+}
+
+// Equal reports whether both fingerprints belong to the same certificate.
+func (f CertificateFingerprint) Equal(other CertificateFingerprint) bool {
+	return f.SHA256 == other.SHA256 && f.Serial == other.Serial && bytes.Equal(f.PublicKey, other.PublicKey)
+}
+
+// ParseCertificateFingerprint fingerprints the leaf, i.e. the first
+// certificate, of a PEM encoded chain.
+func ParseCertificateFingerprint(certPEM []byte) (CertificateFingerprint, error) {
+	var fingerprint CertificateFingerprint
+
+	der, err := leafCertificateDER(certPEM)
+	if err != nil {
+		return fingerprint, err
+	}
+
+	sum := sha256.Sum256(der)
+	fingerprint.SHA256 = hex.EncodeToString(sum[:])
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		// fall back to sm2 certificates, which crypto/x509 cannot parse
+		serial, publicKeyInfo, sm2Err := parseSM2Certificate(der)
+		if sm2Err != nil {
+			err := fmt.Errorf("unable to parse certificate with error: %s", err)
+			return fingerprint, err
+		}
+
+		fingerprint.Serial = serial.Text(16)
+		fingerprint.PublicKey = publicKeyInfo
+
+		return fingerprint, nil
+	}
+
+	fingerprint.Serial = leaf.SerialNumber.Text(16)
+	fingerprint.PublicKey = leaf.RawSubjectPublicKeyInfo
+
+	return fingerprint, nil
+}
+
+// PrivateKeyMatches reports whether the PEM encoded private key belongs to
+// the certificate with the given fingerprint.
+func PrivateKeyMatches(fingerprint CertificateFingerprint, keyPEM []byte) (bool, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		err := fmt.Errorf("unable to decode private key pem")
+		return false, err
+	}
+
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		if matched, sm2Err := sm2PrivateKeyMatches(fingerprint.PublicKey, block.Bytes); sm2Err == nil {
+			return matched, nil
+		}
+
+		return false, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		err := fmt.Errorf("unsupported private key type %T", key)
+		return false, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		err := fmt.Errorf("unable to encode public key of private key with error: %s", err)
+		return false, err
+	}
+
+	return bytes.Equal(publicKey, fingerprint.PublicKey), nil
+}
+
+func leafCertificateDER(certPEM []byte) ([]byte, error) {
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			err := fmt.Errorf("no certificate found in pem data")
+			return nil, err
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		return block.Bytes, nil
+	}
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unable to parse private key, expected PKCS#8, PKCS#1 or EC private key")
+}
@@ -0,0 +1,316 @@
+package tencent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+var (
+	instanceDeployPollInterval = 5 * time.Second
+	instanceDeployPollAttempts = 60
+)
+
+// CertificateInstance lists explicit resource instances a certificate is
+// deployed to, e.g. "lb-xxx|lbl-xxx" listeners for clb or domains for cdn.
+type CertificateInstance struct {
+	ResourceType string
+	InstanceIDs  []string
+}
+
+type InstanceDeployDetail struct {
+	ID         int          `json:"Id"`
+	CertID     string       `json:"CertId"`
+	OldCertID  string       `json:"OldCertId"`
+	InstanceID string       `json:"InstanceId"`
+	ListenerID string       `json:"ListenerId"`
+	Domains    []string     `json:"Domains"`
+	Status     DeployStatus `json:"Status"`
+	ErrorMsg   string       `json:"ErrorMsg"`
+}
+
+type instanceDeployRecord struct {
+	TotalCount             int                    `json:"TotalCount"`
+	DeployRecordDetailList []InstanceDeployDetail `json:"DeployRecordDetailList"`
+	SuccessTotalCount      int                    `json:"SuccessTotalCount"`
+	FailedTotalCount       int                    `json:"FailedTotalCount"`
+	RunningTotalCount      int                    `json:"RunningTotalCount"`
+}
+
+// ReplaceOnInstances uploads the secret certificate as a new certificate and
+// deploys it to the configured instances. The new certificate carries the
+// pending alias until the previous one is retired, so the alias never
+// resolves to both; when a deployment fails the affected instances are moved
+// back to the previous certificate.
+func (t *TencentSSLCertificate) ReplaceOnInstances(client SSLClient) (string, error) {
+	oldCertID := t.CertificateID
+
+	newCertID, err := t.uploadCertificate(client, t.PendingAlias())
+	if err != nil {
+		return "", err
+	}
+
+	logger.Logger.Info(fmt.Sprintf("uploaded certificate %s as %s, deploying it to configured instances", t.CertificateName, newCertID))
+
+	err = t.DeployToInstances(client, newCertID, oldCertID, t.CertificateInstances)
+	if err != nil {
+		t.discardCertificate(client, newCertID)
+		return "", err
+	}
+
+	// the next run replaces the certificate again when the retire fails,
+	// the pending one is left to the orphan scanner once it is unbound
+	if oldCertID != "" {
+		err := t.RetireCertificate(client, oldCertID)
+		if err != nil {
+			err := fmt.Errorf("certificate %s is deployed as %s but certificate %s could not be retired with error: %w", newCertID, t.PendingAlias(), oldCertID, err)
+			return "", err
+		}
+	}
+
+	_, err = t.ModifyCertificateName(client, newCertID, t.CertificateName)
+	if err != nil {
+		return "", err
+	}
+
+	t.CertificateID = newCertID
+
+	return newCertID, nil
+}
+
+// PendingAlias is the alias of a certificate ReplaceOnInstances uploaded
+// while the certificate it replaces still holds the alias.
+func (t *TencentSSLCertificate) PendingAlias() string {
+	return fmt.Sprintf("%s-pending", t.CertificateName)
+}
+
+// DeployToInstances deploys certID to instances group by group and waits
+// for each deployment to finish. It stops at the first failed group and,
+// when there is an oldCertID, moves every group deployed so far back to it,
+// so the target never runs two certificates.
+func (t *TencentSSLCertificate) DeployToInstances(client SSLClient, certID string, oldCertID string, instances []CertificateInstance) error {
+	for i, instance := range instances {
+		recordID, err := t.DeployCertificateInstance(client, certID, oldCertID, instance)
+		if err != nil {
+			t.rollbackInstances(client, certID, oldCertID, instances[:i])
+			return err
+		}
+
+		failed, err := t.WaitInstanceDeployment(client, recordID)
+		if err != nil {
+			t.rollbackInstances(client, certID, oldCertID, instances[:i+1])
+			return err
+		}
+
+		if len(failed) == 0 {
+			logger.Logger.Info(fmt.Sprintf("certificate %s is deployed to %d %s instances", certID, len(instance.InstanceIDs), instance.ResourceType))
+			continue
+		}
+
+		for _, detail := range failed {
+			logger.Logger.Error(fmt.Sprintf("deployment of certificate %s to %s instance %s failed with error: %s", certID, instance.ResourceType, detail.InstanceID, detail.ErrorMsg))
+		}
+
+		err = &DeploymentFailedError{
+			Message: fmt.Sprintf("deployment of certificate %s to %d %s instances failed", t.CertificateName, len(failed), instance.ResourceType),
+			Records: []CertificateDeployRecord{
+				{
+					ID:            recordID,
+					CertID:        certID,
+					OldCertID:     oldCertID,
+					ResourceTypes: []string{instance.ResourceType},
+					Status:        DeployStatusFailed,
+				},
+			},
+			Rollbacks: t.rollbackInstances(client, certID, oldCertID, instances[:i+1]),
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DeployCertificateInstance deploys certID to the instances, oldCertID is
+// the certificate it replaces there.
+func (t *TencentSSLCertificate) DeployCertificateInstance(client SSLClient, certID string, oldCertID string, instance CertificateInstance) (int, error) {
+	var deployment certificateDeployment
+
+	request := sslCertificate.NewDeployCertificateInstanceRequest()
+	request.CertificateId = common.StringPtr(certID)
+	request.ResourceType = common.StringPtr(instance.ResourceType)
+	request.InstanceIdList = common.StringPtrs(instance.InstanceIDs)
+
+	var resources []string
+	for _, instanceID := range instance.InstanceIDs {
+		resources = append(resources, instance.ResourceType+"/"+instanceID)
+	}
+
+	var response *sslCertificate.DeployCertificateInstanceResponse
+	err := withMutationRetry(t.Context, "DeployCertificateInstance", func() error {
+		if err := waitRateLimit(t.Context, "DeployCertificateInstance"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.DeployCertificateInstanceWithContext(t.Context, request)
+		t.audit(audit.Event{
+			Action:           "DeployCertificateInstance",
+			CertificateID:    certID,
+			OldCertificateID: oldCertID,
+			Resources:        resources,
+		}, response, err)
+		return err
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to deploy certificate %s to %s instances with error: %w", certID, instance.ResourceType, err)
+		return 0, err
+	}
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		err := fmt.Errorf("invalid response while deploying certificate %s with error: %s", certID, err)
+		return 0, err
+	}
+
+	err = json.Unmarshal(data, &deployment)
+	if err != nil {
+		err := fmt.Errorf("unable to parse deploy response with error: %s", err)
+		return 0, err
+	}
+
+	return deployment.DeployRecordID, nil
+}
+
+// WaitInstanceDeployment polls a DeployCertificateInstance record until no
+// instance is still deploying and returns the failed instances.
+func (t *TencentSSLCertificate) WaitInstanceDeployment(client SSLClient, recordID int) ([]InstanceDeployDetail, error) {
+	for attempt := 0; attempt < instanceDeployPollAttempts; attempt++ {
+		select {
+		case <-t.Context.Done():
+			return nil, t.Context.Err()
+		case <-time.After(instanceDeployPollInterval):
+		}
+
+		record, err := t.DescribeInstanceDeployment(client, recordID)
+		if err != nil {
+			return nil, err
+		}
+
+		if record.TotalCount == 0 || record.RunningTotalCount > 0 {
+			logger.Logger.Info(fmt.Sprintf("deployment %d is still running, so we are waiting for it to complete", recordID))
+			continue
+		}
+
+		var failed []InstanceDeployDetail
+		for _, detail := range record.DeployRecordDetailList {
+			if detail.Status.Failed() {
+				failed = append(failed, detail)
+			}
+		}
+
+		return failed, nil
+	}
+
+	err := fmt.Errorf("deployment %d did not finish in time", recordID)
+	return nil, err
+}
+
+func (t *TencentSSLCertificate) DescribeInstanceDeployment(client SSLClient, recordID int) (instanceDeployRecord, error) {
+	var record instanceDeployRecord
+
+	request := sslCertificate.NewDescribeHostDeployRecordDetailRequest()
+	request.DeployRecordId = common.StringPtr(strconv.Itoa(recordID))
+	request.Limit = common.Uint64Ptr(certificatePageSize)
+
+	var response *sslCertificate.DescribeHostDeployRecordDetailResponse
+	err := withRetry(t.Context, "DescribeHostDeployRecordDetail", func() error {
+		if err := waitRateLimit(t.Context, "DescribeHostDeployRecordDetail"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.DescribeHostDeployRecordDetailWithContext(t.Context, request)
+		return err
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to get deployment %d with error: %w", recordID, err)
+		return record, err
+	}
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		err := fmt.Errorf("invalid response while getting deployment %d with error: %s", recordID, err)
+		return record, err
+	}
+
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		err := fmt.Errorf("unable to parse deployment response with error: %s", err)
+		return record, err
+	}
+
+	return record, nil
+}
+
+func (t *TencentSSLCertificate) rollbackInstances(client SSLClient, certID string, oldCertID string, instances []CertificateInstance) []RollbackResult {
+	var results []RollbackResult
+	if oldCertID == "" {
+		return results
+	}
+
+	for _, instance := range instances {
+		result := RollbackResult{
+			FailedCertificateID:   certID,
+			RestoredCertificateID: oldCertID,
+			ResourceTypes:         []string{instance.ResourceType},
+		}
+
+		logger.Logger.Info(fmt.Sprintf("rolling back %s instances of certificate %s to %s", instance.ResourceType, certID, oldCertID))
+
+		recordID, err := t.DeployCertificateInstance(client, oldCertID, certID, instance)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.DeployRecordID = recordID
+
+		failed, err := t.WaitInstanceDeployment(client, recordID)
+		if err != nil {
+			result.Error = err.Error()
+		} else if len(failed) > 0 {
+			result.Error = fmt.Sprintf("rollback deployment %d failed for %d instances", recordID, len(failed))
+		} else {
+			result.Succeeded = true
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// discardCertificate removes a certificate that could not be deployed, so it
+// does not shadow the current one under the same alias.
+func (t *TencentSSLCertificate) discardCertificate(client SSLClient, certID string) {
+	_, err := t.DeleteCertificate(client, certID)
+	if err == nil {
+		return
+	}
+
+	alias := fmt.Sprintf("%s-failed-%s", t.CertificateName, time.Now().UTC().Format(versionTimeLayout))
+
+	logger.Logger.Info(fmt.Sprintf("unable to delete undeployed certificate %s, relabelling it as %s", certID, alias))
+
+	_, err = t.ModifyCertificateName(client, certID, alias)
+	if err != nil {
+		logger.Logger.Error(fmt.Sprintf("unable to relabel undeployed certificate %s with error: %s", certID, err))
+	}
+}
@@ -0,0 +1,94 @@
+package tencent
+
+import (
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+)
+
+func TestReplaceOnInstances(t *testing.T) {
+	fastPolling(t)
+
+	// testInstances returns a target holding a new key pair for a
+	// certificate deployed to one clb listener, and the fake running the
+	// current certificate there.
+	testInstances := func(t *testing.T) (*TencentSSLCertificate, *fake.SSLClient, string) {
+		client := fake.NewSSLClient()
+		target := testTarget(t, "app", "app.example.com")
+		target.CertificateInstances = []CertificateInstance{{ResourceType: "clb", InstanceIDs: []string{"lb-1|lbl-1"}}}
+
+		certPEM, keyPEM := testCertificate(t, "app.example.com")
+		oldCertID := client.AddCertificate(fake.Certificate{
+			Alias:      "app",
+			PublicKey:  certPEM,
+			PrivateKey: keyPEM,
+			Status:     fake.CertificateStatusIssued,
+			Tags:       target.Tags,
+		})
+		client.BindInstance("clb", "lb-1|lbl-1", oldCertID)
+		target.CertificateID = oldCertID
+
+		return target, client, oldCertID
+	}
+
+	t.Run("new certificate takes over the alias", func(t *testing.T) {
+		target, client, oldCertID := testInstances(t)
+
+		newCertID, err := target.ReplaceOnInstances(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if running, _ := client.InstanceCertificate("clb", "lb-1|lbl-1"); running != newCertID {
+			t.Errorf("instance runs %s, want %s", running, newCertID)
+		}
+
+		if _, ok := client.Certificate(oldCertID); ok {
+			t.Errorf("replaced certificate %s was not retired", oldCertID)
+		}
+
+		certID, err := target.GetCertificateID(client)
+		if err != nil || certID != newCertID {
+			t.Errorf("alias resolves to %s with error %v, want %s", certID, err, newCertID)
+		}
+	})
+
+	t.Run("failed retire keeps the alias unambiguous", func(t *testing.T) {
+		target, client, oldCertID := testInstances(t)
+
+		// with retention disabled the replaced certificate is deleted, and
+		// relabelled when it cannot be
+		client.InjectError("DeleteCertificate", "FailedOperation", "certificate is in use", 1)
+		client.InjectError("ModifyCertificateAlias", "FailedOperation", "alias cannot be changed", 1)
+
+		_, err := target.ReplaceOnInstances(client)
+		if err == nil {
+			t.Fatal("got no error, want the failed retire")
+		}
+
+		running, _ := client.InstanceCertificate("clb", "lb-1|lbl-1")
+		if running == oldCertID {
+			t.Fatal("new certificate was not deployed")
+		}
+
+		if pending, _ := client.Certificate(running); pending.Alias != target.PendingAlias() {
+			t.Errorf("deployed certificate has alias %s, want %s", pending.Alias, target.PendingAlias())
+		}
+
+		certID, err := target.GetCertificateID(client)
+		if err != nil || certID != oldCertID {
+			t.Fatalf("alias resolves to %s with error %v, want %s", certID, err, oldCertID)
+		}
+
+		// the next run replaces the certificate again
+		newCertID, err := target.ReplaceOnInstances(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certID, err = target.GetCertificateID(client)
+		if err != nil || certID != newCertID {
+			t.Errorf("alias resolves to %s with error %v, want %s", certID, err, newCertID)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package tencent
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// InventoryCertificate is a certificate of an account found by ListInventory.
+type InventoryCertificate struct {
+	CertificateID  string
+	Alias          string
+	Domain         string
+	Status         uint64
+	ExpiresAt      time.Time
+	BoundResources []string
+	Tags           map[string]string
+	Managed        bool
+}
+
+// Expired reports whether the certificate expired before now.
+func (c InventoryCertificate) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !c.ExpiresAt.After(now)
+}
+
+// ListInventory pages through every issued and expired certificate of the
+// account, sorted by expiry. Certificates carrying the managed-by tag of
+// tendo are marked as managed.
+func (t *TencentSSLCertificate) ListInventory(client SSLClient) ([]InventoryCertificate, error) {
+	certificates, err := t.listCertificates(client, "", nil, []uint64{CertificateStatusIssued, CertificateStatusExpired})
+	if err != nil {
+		err := fmt.Errorf("unable to list certificates for inventory with error: %w", err)
+		return nil, err
+	}
+
+	var inventory []InventoryCertificate
+	for _, cert := range certificates {
+		inventory = append(inventory, InventoryCertificate{
+			CertificateID:  cert.CertificateID,
+			Alias:          cert.Alias,
+			Domain:         cert.Domain,
+			Status:         cert.Status,
+			ExpiresAt:      certificateEndTime(cert),
+			BoundResources: cert.BoundResource,
+			Tags:           cert.TagMap(),
+			Managed:        cert.TagMap()[TagManagedBy] == ManagedByTendo,
+		})
+	}
+
+	sort.SliceStable(inventory, func(i, j int) bool {
+		return inventory[i].ExpiresAt.Before(inventory[j].ExpiresAt)
+	})
+
+	return inventory, nil
+}
@@ -0,0 +1,132 @@
+package tencent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/profile"
+)
+
+// DefaultRootDomain serves the Tencent Cloud APIs as <service>.<root domain>.
+// Clients inside a Tencent Cloud VPC can use internal.tencentcloudapi.com.
+const DefaultRootDomain = "tencentcloudapi.com"
+
+// ClientOptions configures how Tencent Cloud API clients connect.
+type ClientOptions struct {
+	// Endpoint and CLBEndpoint override the host of the SSL and CLB APIs. An
+	// endpoint may carry a scheme, e.g. http://127.0.0.1:9000 for the local
+	// stand-in served by "tendo fake-tencent".
+	Endpoint    string
+	CLBEndpoint string
+
+	// RootDomain builds the endpoint of APIs without an explicit one.
+	RootDomain string
+
+	// Proxy is an http, https or socks5 proxy URL. Without it the
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string
+
+	// CABundle is a PEM file of CA certificates trusted in addition to the
+	// system ones, e.g. for a TLS intercepting egress proxy.
+	CABundle string
+
+	// RequestTimeout limits each API request, the SDK default is 60s.
+	RequestTimeout time.Duration
+}
+
+var (
+	transportMu sync.Mutex
+	transports  = map[string]http.RoundTripper{}
+)
+
+// profile builds the client profile of service, e.g. "ssl", using endpoint
+// when it is set.
+func (o ClientOptions) profile(service string, endpoint string) *profile.ClientProfile {
+	rootDomain := o.RootDomain
+	if rootDomain == "" {
+		rootDomain = DefaultRootDomain
+	}
+
+	clientProfile := profile.NewClientProfile()
+	clientProfile.HttpProfile.Endpoint = fmt.Sprintf("%s.%s", service, rootDomain)
+
+	if endpoint != "" {
+		scheme, host, found := strings.Cut(endpoint, "://")
+		if !found {
+			scheme, host = "https", endpoint
+		}
+
+		clientProfile.HttpProfile.Scheme = strings.ToUpper(scheme)
+		clientProfile.HttpProfile.Endpoint = strings.TrimSuffix(host, "/")
+	}
+
+	if o.RequestTimeout > 0 {
+		clientProfile.HttpProfile.ReqTimeout = int(math.Ceil(o.RequestTimeout.Seconds()))
+	}
+
+	return clientProfile
+}
+
+// transport returns the HTTP transport for the proxy and CA bundle options,
+// or nil when the SDK default transport will do. Transports are shared, so
+// clients built on every watch tick reuse their connections.
+func (o ClientOptions) transport() (http.RoundTripper, error) {
+	if o.Proxy == "" && o.CABundle == "" {
+		return nil, nil
+	}
+
+	key := o.Proxy + "|" + o.CABundle
+
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	if transport, ok := transports[key]; ok {
+		return transport, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.Proxy != "" {
+		proxyURL, err := url.Parse(o.Proxy)
+		if err != nil {
+			err := fmt.Errorf("invalid tencent cloud proxy %s with error: %s", o.Proxy, err)
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if o.CABundle != "" {
+		bundle, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			err := fmt.Errorf("unable to read tencent cloud ca bundle %s with error: %s", o.CABundle, err)
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(bundle) {
+			err := fmt.Errorf("no certificates found in tencent cloud ca bundle %s", o.CABundle)
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+	}
+
+	transports[key] = transport
+
+	return transport, nil
+}
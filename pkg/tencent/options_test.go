@@ -0,0 +1,191 @@
+package tencent
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/profile"
+)
+
+func TestClientOptionsProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  ClientOptions
+		endpoint string
+		scheme   string
+		host     string
+		timeout  int
+	}{
+		{
+			name: "default endpoint",
+			host: "ssl.tencentcloudapi.com",
+		},
+		{
+			name:    "internal root domain",
+			options: ClientOptions{RootDomain: "internal.tencentcloudapi.com"},
+			host:    "ssl.internal.tencentcloudapi.com",
+		},
+		{
+			name:     "endpoint without scheme",
+			options:  ClientOptions{RootDomain: "internal.tencentcloudapi.com"},
+			endpoint: "ssl.ap-singapore.tencentcloudapi.com",
+			scheme:   "HTTPS",
+			host:     "ssl.ap-singapore.tencentcloudapi.com",
+		},
+		{
+			name:     "local stand-in",
+			endpoint: "http://127.0.0.1:9000/",
+			scheme:   "HTTP",
+			host:     "127.0.0.1:9000",
+		},
+		{
+			name:    "request timeout rounded up to seconds",
+			options: ClientOptions{RequestTimeout: 2500 * time.Millisecond},
+			host:    "ssl.tencentcloudapi.com",
+			timeout: 3,
+		},
+	}
+
+	// without a setting the sdk defaults apply
+	defaults := profile.NewHttpProfile()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientProfile := test.options.profile("ssl", test.endpoint)
+
+			scheme := test.scheme
+			if scheme == "" {
+				scheme = defaults.Scheme
+			}
+
+			if clientProfile.HttpProfile.Scheme != scheme || clientProfile.HttpProfile.Endpoint != test.host {
+				t.Errorf("got %s://%s, want %s://%s", clientProfile.HttpProfile.Scheme, clientProfile.HttpProfile.Endpoint, scheme, test.host)
+			}
+
+			timeout := test.timeout
+			if timeout == 0 {
+				timeout = defaults.ReqTimeout
+			}
+
+			if clientProfile.HttpProfile.ReqTimeout != timeout {
+				t.Errorf("got timeout %ds, want %ds", clientProfile.HttpProfile.ReqTimeout, timeout)
+			}
+		})
+	}
+}
+
+func TestClientOptionsTransport(t *testing.T) {
+	// list lists the certificates through a client built with options
+	list := func(t *testing.T, options ClientOptions) error {
+		t.Helper()
+
+		target := testTarget(t, "app", "app.example.com")
+		target.Credentials = common.NewCredential("AKIDtendotest", "tendo-test-secret")
+		target.Region = "ap-singapore"
+		target.ClientOptions = options
+
+		client, err := target.BuildClient()
+		if err != nil {
+			return err
+		}
+
+		_, err = target.ListCertificates(client, "app", nil)
+		return err
+	}
+
+	t.Run("default transport without proxy or ca bundle", func(t *testing.T) {
+		transport, err := ClientOptions{Endpoint: "http://127.0.0.1:9000"}.transport()
+		if err != nil || transport != nil {
+			t.Errorf("got transport %v with error %v, want the sdk default", transport, err)
+		}
+	})
+
+	t.Run("requests go through the proxy", func(t *testing.T) {
+		_, standIn := fake.StartServer(fake.NewSSLClient())
+		defer standIn.Close()
+
+		var proxied atomic.Int32
+		forward := &httputil.ReverseProxy{
+			Director: func(r *http.Request) {},
+		}
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied.Add(1)
+			forward.ServeHTTP(w, r)
+		}))
+		defer proxy.Close()
+
+		err := list(t, ClientOptions{Endpoint: standIn.URL, Proxy: proxy.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if proxied.Load() != 1 {
+			t.Errorf("got %d proxied requests, want 1", proxied.Load())
+		}
+	})
+
+	t.Run("stand-in is trusted through the ca bundle", func(t *testing.T) {
+		standIn := httptest.NewTLSServer(fake.NewServer(fake.NewSSLClient()))
+		defer standIn.Close()
+
+		if err := list(t, ClientOptions{Endpoint: standIn.URL}); err == nil {
+			t.Fatal("got no error, want the certificate of the stand-in rejected without the ca bundle")
+		}
+
+		bundle := filepath.Join(t.TempDir(), "ca.pem")
+		err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: standIn.Certificate().Raw}), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = list(t, ClientOptions{Endpoint: standIn.URL, CABundle: bundle})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("transports are shared between clients", func(t *testing.T) {
+		options := ClientOptions{Proxy: "http://proxy.example.com:3128"}
+
+		first, err := options.transport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := options.transport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first != second {
+			t.Error("got a new transport, want the one built for the same options")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.pem")
+		if err := os.WriteFile(empty, []byte("no certificates here"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, options := range map[string]ClientOptions{
+			"proxy url":         {Proxy: "http://proxy example.com"},
+			"missing ca bundle": {CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+			"empty ca bundle":   {CABundle: empty},
+		} {
+			_, err := options.transport()
+			if err == nil {
+				t.Errorf("%s: got no error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package tencent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Reasons the orphan scanner lists a certificate for.
+const (
+	// OrphanUnbound certificates were uploaded by tendo for a secret no watch
+	// target reads anymore.
+	OrphanUnbound = "unbound"
+	// OrphanDuplicate certificates share the alias of a watch target with a
+	// newer or bound certificate, e.g. after a failed run uploaded twice.
+	OrphanDuplicate = "duplicate"
+	// OrphanSuperseded certificates are replaced versions beyond the
+	// retention of their watch target.
+	OrphanSuperseded = "superseded"
+)
+
+// OrphanOwner is a certificate name tendo manages for a current watch
+// target. Tags are the provenance tags of the target, Retention decides how
+// many superseded "<CertificateName>-v<timestamp>" versions it keeps.
+type OrphanOwner struct {
+	CertificateName string
+	Tags            map[string]string
+	Retention       RetentionPolicy
+}
+
+// OrphanCertificate is a certificate FindOrphans considers safe to delete.
+type OrphanCertificate struct {
+	CertificateID string
+	Alias         string
+	Domain        string
+	ExpiresAt     time.Time
+	Reason        string
+	// Owner is the certificate name of the watch target the certificate
+	// belonged to, empty for unbound certificates.
+	Owner string
+}
+
+type ownedVersion struct {
+	cert         InventoryCertificate
+	supersededAt time.Time
+}
+
+// FindOrphans compares the certificates of an account with the certificate
+// names of the current watch targets. Certificates bound to any resource
+// are never orphans, neither is the newest certificate of a watch target.
+// Tagged certificates only count as unbound when their tendo-cluster tag is
+// one of clusters, so certificates of other tendo installations sharing the
+// account are left alone.
+func FindOrphans(certificates []InventoryCertificate, owners []OrphanOwner, clusters []string, now time.Time) []OrphanCertificate {
+	current := map[string][]InventoryCertificate{}
+	versions := map[string][]ownedVersion{}
+	var orphans []OrphanCertificate
+
+	patterns := versionPatterns(owners)
+
+	for _, cert := range certificates {
+		owner, supersededAt, found := findOwner(cert, owners, patterns)
+		if !found {
+			tags := cert.Tags
+			if tags[TagManagedBy] != ManagedByTendo || len(cert.BoundResources) > 0 || !containsString(clusters, tags[TagCluster]) {
+				continue
+			}
+
+			// certificates of a renamed target still carry its tags
+			reason := OrphanUnbound
+			for _, value := range owners {
+				if len(value.Tags) > 0 && tagsMatch(tags, value.Tags) {
+					owner, reason = value, OrphanSuperseded
+					break
+				}
+			}
+
+			orphans = append(orphans, newOrphan(cert, reason, owner.CertificateName))
+			continue
+		}
+
+		if supersededAt.IsZero() {
+			current[owner.CertificateName] = append(current[owner.CertificateName], cert)
+		} else {
+			versions[owner.CertificateName] = append(versions[owner.CertificateName], ownedVersion{
+				cert:         cert,
+				supersededAt: supersededAt,
+			})
+		}
+	}
+
+	for name, certs := range current {
+		orphans = append(orphans, findDuplicates(name, certs)...)
+	}
+
+	for _, owner := range owners {
+		owned := versions[owner.CertificateName]
+		sort.Slice(owned, func(i, j int) bool {
+			return owned[i].supersededAt.After(owned[j].supersededAt)
+		})
+
+		for i, version := range owned {
+			if i < owner.Retention.Keep || now.Sub(version.supersededAt) < owner.Retention.GracePeriod {
+				continue
+			}
+
+			if len(version.cert.BoundResources) > 0 {
+				continue
+			}
+
+			orphans = append(orphans, newOrphan(version.cert, OrphanSuperseded, owner.CertificateName))
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Owner != orphans[j].Owner {
+			return orphans[i].Owner < orphans[j].Owner
+		}
+
+		return orphans[i].CertificateID < orphans[j].CertificateID
+	})
+
+	return orphans
+}
+
+// versionPatterns matches the "<CertificateName>-v<timestamp>" aliases of
+// the superseded versions of each owner.
+func versionPatterns(owners []OrphanOwner) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(owners))
+	for i, owner := range owners {
+		patterns[i] = regexp.MustCompile("^" + regexp.QuoteMeta(owner.CertificateName) + `-v(\d{14})$`)
+	}
+
+	return patterns
+}
+
+// findOwner returns the watch target a certificate belongs to by alias, and
+// when the certificate was superseded if the alias is a version one.
+// patterns are the versionPatterns of owners.
+func findOwner(cert InventoryCertificate, owners []OrphanOwner, patterns []*regexp.Regexp) (OrphanOwner, time.Time, bool) {
+	for i, owner := range owners {
+		if cert.Alias == owner.CertificateName {
+			return owner, time.Time{}, true
+		}
+
+		match := patterns[i].FindStringSubmatch(cert.Alias)
+		if match == nil {
+			continue
+		}
+
+		supersededAt, err := time.Parse(versionTimeLayout, match[1])
+		if err != nil {
+			continue
+		}
+
+		return owner, supersededAt, true
+	}
+
+	return OrphanOwner{}, time.Time{}, false
+}
+
+// findDuplicates keeps every bound certificate of a watch target, or the one
+// expiring last when none is bound, and lists the others.
+func findDuplicates(name string, certs []InventoryCertificate) []OrphanCertificate {
+	var bound []InventoryCertificate
+	for _, cert := range certs {
+		if len(cert.BoundResources) > 0 {
+			bound = append(bound, cert)
+		}
+	}
+
+	keep := map[string]bool{}
+	for _, cert := range bound {
+		keep[cert.CertificateID] = true
+	}
+
+	if len(bound) == 0 {
+		newest := certs[0]
+		for _, cert := range certs[1:] {
+			if cert.ExpiresAt.After(newest.ExpiresAt) {
+				newest = cert
+			}
+		}
+		keep[newest.CertificateID] = true
+	}
+
+	var orphans []OrphanCertificate
+	for _, cert := range certs {
+		if !keep[cert.CertificateID] {
+			orphans = append(orphans, newOrphan(cert, OrphanDuplicate, name))
+		}
+	}
+
+	return orphans
+}
+
+func tagsMatch(tags map[string]string, want map[string]string) bool {
+	for key, value := range want {
+		if tags[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newOrphan(cert InventoryCertificate, reason string, owner string) OrphanCertificate {
+	return OrphanCertificate{
+		CertificateID: cert.CertificateID,
+		Alias:         cert.Alias,
+		Domain:        cert.Domain,
+		ExpiresAt:     cert.ExpiresAt,
+		Reason:        reason,
+		Owner:         owner,
+	}
+}
+
+// DeleteOrphans deletes the orphaned certificates. It carries on past
+// failures and returns them all, a certificate bound since the scan is
+// refused by tencent cloud.
+func (t *TencentSSLCertificate) DeleteOrphans(client SSLClient, orphans []OrphanCertificate) ([]string, error) {
+	var deleted []string
+	var errs []error
+
+	for _, orphan := range orphans {
+		_, err := t.DeleteCertificate(client, orphan.CertificateID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		deleted = append(deleted, orphan.CertificateID)
+	}
+
+	if len(errs) > 0 {
+		err := fmt.Errorf("unable to delete %d of %d orphaned certificates: %w", len(errs), len(orphans), errors.Join(errs...))
+		return deleted, err
+	}
+
+	return deleted, nil
+}
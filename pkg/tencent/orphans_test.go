@@ -0,0 +1,132 @@
+package tencent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Now()
+
+	owners := []OrphanOwner{
+		{
+			CertificateName: "app",
+			Tags:            ProvenanceTags("prod", "tendo", "app"),
+			Retention:       RetentionPolicy{Keep: 1, GracePeriod: 24 * time.Hour},
+		},
+	}
+
+	version := func(id string, supersededAt time.Time) InventoryCertificate {
+		return InventoryCertificate{
+			CertificateID: id,
+			Alias:         "app-v" + supersededAt.UTC().Format(versionTimeLayout),
+			ExpiresAt:     now.Add(30 * 24 * time.Hour),
+		}
+	}
+
+	tests := []struct {
+		name         string
+		certificates []InventoryCertificate
+		clusters     []string
+		want         map[string]string
+	}{
+		{
+			name: "unbound duplicate next to a bound certificate",
+			certificates: []InventoryCertificate{
+				{CertificateID: "bound", Alias: "app", ExpiresAt: now.Add(time.Hour), BoundResources: []string{"clb"}},
+				{CertificateID: "newer", Alias: "app", ExpiresAt: now.Add(48 * time.Hour)},
+			},
+			want: map[string]string{"newer": OrphanDuplicate},
+		},
+		{
+			name: "older duplicate when none is bound",
+			certificates: []InventoryCertificate{
+				{CertificateID: "older", Alias: "app", ExpiresAt: now.Add(time.Hour)},
+				{CertificateID: "newer", Alias: "app", ExpiresAt: now.Add(48 * time.Hour)},
+			},
+			want: map[string]string{"older": OrphanDuplicate},
+		},
+		{
+			name: "versions beyond retention and grace period",
+			certificates: []InventoryCertificate{
+				version("old", now.Add(-72*time.Hour)),
+				version("newest", now.Add(-6*time.Hour)),
+				version("grace", now.Add(-20*time.Hour)),
+			},
+			want: map[string]string{"old": OrphanSuperseded},
+		},
+		{
+			name: "bound version is kept",
+			certificates: []InventoryCertificate{
+				version("kept", now.Add(-72*time.Hour)),
+				func() InventoryCertificate {
+					cert := version("bound", now.Add(-96*time.Hour))
+					cert.BoundResources = []string{"cdn"}
+					return cert
+				}(),
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "unbound certificate of a known cluster",
+			certificates: []InventoryCertificate{
+				{CertificateID: "gone", Alias: "gone", Tags: ProvenanceTags("prod", "tendo", "gone")},
+			},
+			clusters: []string{"prod"},
+			want:     map[string]string{"gone": OrphanUnbound},
+		},
+		{
+			name: "unbound certificate of another cluster",
+			certificates: []InventoryCertificate{
+				{CertificateID: "other", Alias: "other", Tags: ProvenanceTags("staging", "tendo", "other")},
+			},
+			clusters: []string{"prod"},
+			want:     map[string]string{},
+		},
+		{
+			name: "no unbound certificates without configured clusters",
+			certificates: []InventoryCertificate{
+				{CertificateID: "other", Alias: "other", Tags: ProvenanceTags("default", "tendo", "other")},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "bound unbound certificate",
+			certificates: []InventoryCertificate{
+				{CertificateID: "gone", Alias: "gone", Tags: ProvenanceTags("prod", "tendo", "gone"), BoundResources: []string{"clb"}},
+			},
+			clusters: []string{"prod"},
+			want:     map[string]string{},
+		},
+		{
+			name: "certificate of a renamed target",
+			certificates: []InventoryCertificate{
+				{CertificateID: "renamed", Alias: "app-old", Tags: ProvenanceTags("prod", "tendo", "app")},
+			},
+			clusters: []string{"prod"},
+			want:     map[string]string{"renamed": OrphanSuperseded},
+		},
+		{
+			name: "untagged certificate of nobody",
+			certificates: []InventoryCertificate{
+				{CertificateID: "manual", Alias: "manual"},
+			},
+			clusters: []string{"prod"},
+			want:     map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, orphan := range FindOrphans(test.certificates, owners, test.clusters, now) {
+				got[orphan.CertificateID] = orphan.Reason
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got orphans %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package tencent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/metrics"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is a token bucket: QPS tokens are added per second, up to Burst.
+type RateLimit struct {
+	QPS   float64
+	Burst int
+}
+
+// DefaultRateLimit stays below the 20 requests per second Tencent Cloud
+// allows for most SSL API actions.
+var DefaultRateLimit = RateLimit{
+	QPS:   10,
+	Burst: 10,
+}
+
+type rateLimiter struct {
+	mu       sync.Mutex
+	defaults RateLimit
+	actions  map[string]RateLimit
+	limiters map[string]*rate.Limiter
+}
+
+// limiter is shared by every TencentSSLCertificate in the process, so the
+// limits hold no matter how many watch targets run at the same time.
+var limiter = &rateLimiter{
+	defaults: DefaultRateLimit,
+	actions:  map[string]RateLimit{},
+	limiters: map[string]*rate.Limiter{},
+}
+
+var (
+	rateLimitRequests = metrics.NewCounterVec(
+		"tendo_tencent_api_requests_total",
+		"Tencent Cloud API requests that passed the client-side rate limiter.",
+		"action",
+	)
+	rateLimitWait = metrics.NewCounterVec(
+		"tendo_tencent_ratelimit_wait_seconds_total",
+		"Time spent waiting for the client-side Tencent Cloud API rate limiter.",
+		"action",
+	)
+)
+
+// ConfigureRateLimits replaces the process-wide limits. Actions without an
+// entry in actions use defaults. Action names are matched case-insensitively.
+func ConfigureRateLimits(defaults RateLimit, actions map[string]RateLimit) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if defaults.QPS <= 0 {
+		defaults.QPS = DefaultRateLimit.QPS
+	}
+
+	if defaults.Burst <= 0 {
+		defaults.Burst = DefaultRateLimit.Burst
+	}
+
+	limiter.defaults = defaults
+	limiter.actions = map[string]RateLimit{}
+	for action, limit := range actions {
+		limiter.actions[strings.ToLower(action)] = limit
+	}
+
+	// rebuild limiters with the new settings on next use
+	limiter.limiters = map[string]*rate.Limiter{}
+}
+
+func (r *rateLimiter) get(action string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := strings.ToLower(action)
+	if l, ok := r.limiters[key]; ok {
+		return l
+	}
+
+	limit, ok := r.actions[key]
+	if !ok {
+		limit = r.defaults
+	}
+
+	if limit.QPS <= 0 {
+		limit.QPS = r.defaults.QPS
+	}
+
+	if limit.Burst <= 0 {
+		limit.Burst = r.defaults.Burst
+	}
+
+	l := rate.NewLimiter(rate.Limit(limit.QPS), limit.Burst)
+	r.limiters[key] = l
+
+	return l
+}
+
+// waitRateLimit blocks until the limiter allows another call of action.
+func waitRateLimit(ctx context.Context, action string) error {
+	start := time.Now()
+
+	err := limiter.get(action).Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	waited := time.Since(start)
+
+	rateLimitRequests.Inc(action)
+	rateLimitWait.Add(waited.Seconds(), action)
+
+	if waited > 10*time.Millisecond {
+		logger.Logger.Debug(fmt.Sprintf("waited %s for the rate limit of %s", waited, action))
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package tencent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"golang.org/x/time/rate"
+)
+
+// testRateLimits configures the limits for the duration of the test.
+func testRateLimits(t *testing.T, defaults RateLimit, actions map[string]RateLimit) {
+	ConfigureRateLimits(defaults, actions)
+
+	t.Cleanup(func() {
+		ConfigureRateLimits(DefaultRateLimit, nil)
+	})
+}
+
+func TestConfigureRateLimits(t *testing.T) {
+	testRateLimits(t, RateLimit{QPS: 5}, map[string]RateLimit{
+		"DescribeCertificates": {QPS: 2, Burst: 4},
+		"deletecertificate":    {QPS: 1},
+	})
+
+	tests := []struct {
+		action string
+		limit  rate.Limit
+		burst  int
+	}{
+		{action: "DescribeCertificates", limit: 2, burst: 4},
+		{action: "describecertificates", limit: 2, burst: 4},
+		// a missing burst falls back to the defaults, a missing default
+		// burst to DefaultRateLimit
+		{action: "DeleteCertificate", limit: 1, burst: DefaultRateLimit.Burst},
+		{action: "UploadCertificate", limit: 5, burst: DefaultRateLimit.Burst},
+	}
+
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			l := limiter.get(test.action)
+			if l.Limit() != test.limit || l.Burst() != test.burst {
+				t.Errorf("got %g per second with burst %d, want %g with burst %d", l.Limit(), l.Burst(), test.limit, test.burst)
+			}
+		})
+	}
+}
+
+func TestWaitRateLimit(t *testing.T) {
+	t.Run("targets share the limit of an action", func(t *testing.T) {
+		testRateLimits(t, DefaultRateLimit, map[string]RateLimit{
+			"DescribeCertificates": {QPS: 20, Burst: 1},
+		})
+
+		client := fake.NewSSLClient()
+		targets := []*TencentSSLCertificate{
+			testTarget(t, "app", "app.example.com"),
+			testTarget(t, "shop", "shop.example.com"),
+		}
+
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			_, err := targets[i%2].ListCertificates(client, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// the first call takes the burst, the other three wait 50ms each
+		if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+			t.Errorf("4 calls took %s, want at least 150ms at 20 per second", elapsed)
+		}
+	})
+
+	t.Run("waiting stops with the context", func(t *testing.T) {
+		testRateLimits(t, DefaultRateLimit, map[string]RateLimit{
+			"DeleteCertificate": {QPS: 0.1, Burst: 1},
+		})
+
+		err := waitRateLimit(context.Background(), "DeleteCertificate")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err = waitRateLimit(ctx, "DeleteCertificate")
+		if err == nil {
+			t.Error("got no error, want the wait to stop with the context")
+		}
+	})
+}
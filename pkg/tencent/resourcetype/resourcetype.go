@@ -0,0 +1,71 @@
+// Package resourcetype enumerates the cloud resource types Tencent SSL
+// certificates can be deployed to. It has no dependencies, so the config
+// package can validate resource types without importing pkg/tencent.
+package resourcetype
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ResourceType string
+
+const (
+	CLB        ResourceType = "clb"
+	CDN        ResourceType = "cdn"
+	WAF        ResourceType = "waf"
+	Live       ResourceType = "live"
+	VOD        ResourceType = "vod"
+	DDoS       ResourceType = "ddos"
+	TKE        ResourceType = "tke"
+	APIGateway ResourceType = "apigateway"
+	TCB        ResourceType = "tcb"
+	TEO        ResourceType = "teo"
+	COS        ResourceType = "cos"
+)
+
+// All lists the supported resource types in the order Tencent documents them.
+var All = []ResourceType{CLB, CDN, WAF, Live, VOD, DDoS, TKE, APIGateway, TCB, TEO, COS}
+
+// regional resource types are deployed per region and need the regions in
+// ResourceTypesRegions, the others are global.
+var regional = map[ResourceType]bool{
+	CLB:        true,
+	WAF:        true,
+	TKE:        true,
+	APIGateway: true,
+	TCB:        true,
+	COS:        true,
+}
+
+// Parse returns the resource type with the given name.
+func Parse(name string) (ResourceType, error) {
+	for _, resourceType := range All {
+		if string(resourceType) == name {
+			return resourceType, nil
+		}
+	}
+
+	err := fmt.Errorf("unsupported resource type %q, supported resource types are %s", name, strings.Join(Names(), ", "))
+	return "", err
+}
+
+// Names returns the names of all supported resource types.
+func Names() []string {
+	var names []string
+	for _, resourceType := range All {
+		names = append(names, string(resourceType))
+	}
+
+	return names
+}
+
+// RequiresRegion reports whether certificates of the resource type are
+// deployed per region.
+func (r ResourceType) RequiresRegion() bool {
+	return regional[r]
+}
+
+func (r ResourceType) String() string {
+	return string(r)
+}
@@ -0,0 +1,148 @@
+package tencent
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+)
+
+// superseded certificates are relabelled "<alias>-v<timestamp>", the
+// timestamp being the moment they were replaced
+const versionTimeLayout = "20060102150405"
+
+// RetentionPolicy controls what happens to a certificate once a new one has
+// been deployed in its place. The zero value deletes it right away.
+type RetentionPolicy struct {
+	// Keep is the number of superseded certificates kept regardless of age.
+	Keep int
+	// GracePeriod is how long older superseded certificates are kept before
+	// they are deleted.
+	GracePeriod time.Duration
+}
+
+// Enabled reports whether superseded certificates are kept as versions
+// instead of being deleted right away.
+func (r RetentionPolicy) Enabled() bool {
+	return r.Keep > 0 || r.GracePeriod > 0
+}
+
+type supersededCertificate struct {
+	CertificateID string
+	SupersededAt  time.Time
+}
+
+// RetireCertificate deletes a superseded certificate, or relabels it with a
+// version suffix when the target retains previous versions or the
+// certificate cannot be deleted.
+func (t *TencentSSLCertificate) RetireCertificate(client SSLClient, certID string) error {
+	if !t.Retention.Enabled() {
+		_, err := t.DeleteCertificate(client, certID)
+		if err == nil {
+			return nil
+		}
+
+		// a certificate still bound to resources outside the configured
+		// instances cannot be deleted, relabel it so the alias stays unique
+		logger.Logger.Info(fmt.Sprintf("unable to delete superseded certificate %s with error: %s", certID, err))
+	}
+
+	alias := fmt.Sprintf("%s-v%s", t.CertificateName, time.Now().UTC().Format(versionTimeLayout))
+
+	logger.Logger.Info(fmt.Sprintf("keeping superseded certificate %s as %s", certID, alias))
+
+	_, err := t.ModifyCertificateName(client, certID, alias)
+	if err != nil {
+		return err
+	}
+
+	return t.PruneCertificates(client)
+}
+
+// PruneCertificates deletes superseded versions beyond the newest Keep ones
+// once they have been superseded for longer than the grace period.
+func (t *TencentSSLCertificate) PruneCertificates(client SSLClient) error {
+	versions, err := t.PrunableCertificates(client)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		logger.Logger.Info(fmt.Sprintf("pruning certificate %s of %s superseded at %s", version.CertificateID, t.CertificateName, version.SupersededAt.Format(time.RFC3339)))
+
+		_, err := t.DeleteCertificate(client, version.CertificateID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PrunableCertificates returns the superseded versions PruneCertificates
+// would delete.
+func (t *TencentSSLCertificate) PrunableCertificates(client SSLClient) ([]supersededCertificate, error) {
+	var prunable []supersededCertificate
+
+	if !t.Retention.Enabled() {
+		return prunable, nil
+	}
+
+	versions, err := t.ListSupersededCertificates(client)
+	if err != nil {
+		return prunable, err
+	}
+
+	if len(versions) <= t.Retention.Keep {
+		return prunable, nil
+	}
+
+	for _, version := range versions[t.Retention.Keep:] {
+		if time.Since(version.SupersededAt) < t.Retention.GracePeriod {
+			continue
+		}
+
+		prunable = append(prunable, version)
+	}
+
+	return prunable, nil
+}
+
+// ListSupersededCertificates lists the retained versions of the target
+// certificate, newest first. Versions which expired in the meantime are
+// listed as well, so they are pruned too.
+func (t *TencentSSLCertificate) ListSupersededCertificates(client SSLClient) ([]supersededCertificate, error) {
+	var versions []supersededCertificate
+
+	certificates, err := t.listCertificates(client, t.CertificateName+"-v", nil, []uint64{CertificateStatusIssued, CertificateStatusExpired})
+	if err != nil {
+		return versions, err
+	}
+
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(t.CertificateName) + `-v(\d{14})$`)
+
+	for _, cert := range certificates {
+		match := pattern.FindStringSubmatch(cert.Alias)
+		if match == nil {
+			continue
+		}
+
+		supersededAt, err := time.Parse(versionTimeLayout, match[1])
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, supersededCertificate{
+			CertificateID: cert.CertificateID,
+			SupersededAt:  supersededAt,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].SupersededAt.After(versions[j].SupersededAt)
+	})
+
+	return versions, nil
+}
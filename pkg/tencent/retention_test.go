@@ -0,0 +1,39 @@
+package tencent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+)
+
+func TestPrunableCertificates(t *testing.T) {
+	client := fake.NewSSLClient()
+	certPEM, keyPEM := testCertificate(t, "app.example.com")
+
+	version := func(supersededAt time.Time, status uint64) string {
+		return client.AddCertificate(fake.Certificate{
+			Alias:      "app-v" + supersededAt.UTC().Format(versionTimeLayout),
+			PublicKey:  certPEM,
+			PrivateKey: keyPEM,
+			Status:     status,
+		})
+	}
+
+	now := time.Now()
+	version(now.Add(-time.Hour), fake.CertificateStatusIssued)
+	issued := version(now.Add(-48*time.Hour), fake.CertificateStatusIssued)
+	expired := version(now.Add(-72*time.Hour), CertificateStatusExpired)
+
+	target := testTarget(t, "app", "app.example.com")
+	target.Retention = RetentionPolicy{Keep: 1, GracePeriod: 24 * time.Hour}
+
+	prunable, err := target.PrunableCertificates(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prunable) != 2 || prunable[0].CertificateID != issued || prunable[1].CertificateID != expired {
+		t.Errorf("got prunable versions %+v, want %s and the expired %s", prunable, issued, expired)
+	}
+}
@@ -0,0 +1,167 @@
+package tencent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    15 * time.Second,
+}
+
+// retryableCodes are Tencent Cloud error codes, or code prefixes, that are
+// worth retrying. Any other SDK error is treated as permanent.
+var retryableCodes = []string{
+	"RequestLimitExceeded",
+	"InternalError",
+	"ClientError.NetworkError",
+	"ClientError.HttpStatusCodeError",
+}
+
+// retryableMutationCodes are the error codes a call changing something in
+// Tencent Cloud is retried on. They are returned before the request is
+// processed, while an InternalError or a network error may come back from a
+// change that was applied, so retrying those could apply it twice.
+var retryableMutationCodes = []string{
+	"RequestLimitExceeded",
+}
+
+// NonRetryableError marks a Tencent Cloud error that is not retried, either
+// because retrying will not fix it, such as AuthFailure or InvalidParameter,
+// or because the failed call may have changed something already.
+type NonRetryableError struct {
+	Code      string
+	RequestID string
+	Err       error
+}
+
+func (e *NonRetryableError) Error() string {
+	return fmt.Sprintf("non-retryable error %s (request id %s): %s", e.Code, e.RequestID, e.Err)
+}
+
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is a Tencent Cloud SDK error with a
+// transient error code.
+func IsRetryable(err error) bool {
+	return hasErrorCode(err, retryableCodes)
+}
+
+// IsRetryableMutation reports whether a call changing something in Tencent
+// Cloud failed with err without taking effect, so it can be retried.
+func IsRetryableMutation(err error) bool {
+	return hasErrorCode(err, retryableMutationCodes)
+}
+
+// hasErrorCode reports whether err is a Tencent Cloud SDK error with one of
+// codes, or a code below one of them.
+func hasErrorCode(err error, codes []string) bool {
+	var sdkError *tencentCloudSDKError.TencentCloudSDKError
+	if !errors.As(err, &sdkError) {
+		return false
+	}
+
+	for _, code := range codes {
+		if sdkError.GetCode() == code || strings.HasPrefix(sdkError.GetCode(), code+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsAuthFailure reports whether err is a Tencent Cloud SDK error caused by
+// rejected credentials, e.g. an expired token.
+func IsAuthFailure(err error) bool {
+	var sdkError *tencentCloudSDKError.TencentCloudSDKError
+	if !errors.As(err, &sdkError) {
+		return false
+	}
+
+	return sdkError.GetCode() == "AuthFailure" || strings.HasPrefix(sdkError.GetCode(), "AuthFailure.")
+}
+
+// withRetry runs call until it succeeds, fails with a permanent error or
+// runs out of attempts, backing off exponentially with jitter in between.
+func withRetry(ctx context.Context, action string, call func() error) error {
+	return retry(ctx, action, IsRetryable, call)
+}
+
+// withMutationRetry is withRetry for calls changing something in Tencent
+// Cloud. They are only retried when they were rejected without taking
+// effect.
+func withMutationRetry(ctx context.Context, action string, call func() error) error {
+	return retry(ctx, action, IsRetryableMutation, call)
+}
+
+func retry(ctx context.Context, action string, retryable func(err error) bool, call func() error) error {
+	policy := DefaultRetryPolicy
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = call()
+		if err == nil {
+			return nil
+		}
+
+		var sdkError *tencentCloudSDKError.TencentCloudSDKError
+		if !errors.As(err, &sdkError) {
+			return err
+		}
+
+		if !retryable(err) {
+			return &NonRetryableError{
+				Code:      sdkError.GetCode(),
+				RequestID: sdkError.GetRequestId(),
+				Err:       err,
+			}
+		}
+
+		if attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		delay := backoff(policy, attempt)
+
+		logger.Logger.Warn(fmt.Sprintf("%s failed with retryable error %s in request %s on attempt %d, retrying in %s", action, sdkError.GetCode(), sdkError.GetRequestId(), attempt, delay))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: half of the capped
+// exponential delay plus a random jitter of up to the other half.
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
@@ -0,0 +1,85 @@
+package tencent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
+)
+
+func sdkError(code string) error {
+	return tencentCloudSDKError.NewTencentCloudSDKError(code, "test error", "test-request")
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		retry    bool
+		mutation bool
+	}{
+		{name: "rate limited", err: sdkError("RequestLimitExceeded"), retry: true, mutation: true},
+		{name: "rate limited sub code", err: sdkError("RequestLimitExceeded.UinLimitExceeded"), retry: true, mutation: true},
+		{name: "internal error", err: sdkError("InternalError"), retry: true},
+		{name: "internal error sub code", err: sdkError("InternalError.BackendTimeout"), retry: true},
+		{name: "network error", err: sdkError("ClientError.NetworkError"), retry: true},
+		{name: "http status error", err: sdkError("ClientError.HttpStatusCodeError"), retry: true},
+		{name: "code sharing a prefix", err: sdkError("InternalErrorous")},
+		{name: "auth failure", err: sdkError("AuthFailure.SignatureExpire")},
+		{name: "invalid parameter", err: sdkError("InvalidParameter")},
+		{name: "wrapped sdk error", err: fmt.Errorf("failed with error: %w", sdkError("InternalError")), retry: true},
+		{name: "not an sdk error", err: errors.New("InternalError")},
+		{name: "no error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.retry {
+				t.Errorf("IsRetryable(%v) = %t, want %t", test.err, got, test.retry)
+			}
+
+			if got := IsRetryableMutation(test.err); got != test.mutation {
+				t.Errorf("IsRetryableMutation(%v) = %t, want %t", test.err, got, test.mutation)
+			}
+		})
+	}
+}
+
+func TestWithMutationRetry(t *testing.T) {
+	policy := DefaultRetryPolicy
+	DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	t.Cleanup(func() {
+		DefaultRetryPolicy = policy
+	})
+
+	tests := []struct {
+		name     string
+		code     string
+		attempts int
+	}{
+		{name: "rate limited call is retried", code: "RequestLimitExceeded", attempts: 3},
+		{name: "internal error is not retried", code: "InternalError", attempts: 1},
+		{name: "network error is not retried", code: "ClientError.NetworkError", attempts: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := withMutationRetry(context.Background(), "UpdateCertificateInstance", func() error {
+				attempts++
+				return sdkError(test.code)
+			})
+
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			if attempts != test.attempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package tencent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+var (
+	rollbackPollInterval = 5 * time.Second
+	rollbackPollAttempts = 24
+)
+
+type RollbackResult struct {
+	FailedCertificateID   string
+	RestoredCertificateID string
+	ResourceTypes         []string
+	Regions               []string
+	DeployRecordID        int
+	Succeeded             bool
+	Error                 string
+}
+
+// DeploymentFailedError is returned when at least one deploy record failed.
+// Rollbacks holds the outcome of moving each failed record back to the
+// previous certificate, Summary the state of all records of the deployment.
+type DeploymentFailedError struct {
+	Message   string
+	Records   []CertificateDeployRecord
+	Rollbacks []RollbackResult
+	Summary   DeploymentSummary
+}
+
+func (e *DeploymentFailedError) Error() string {
+	return e.Message
+}
+
+type certificateDeployment struct {
+	DeployRecordID int          `json:"DeployRecordId"`
+	DeployStatus   DeployStatus `json:"DeployStatus"`
+}
+
+// RollbackDeployment redeploys the previous certificate of a failed deploy
+// record to the record's resource types and regions, then waits for that
+// deployment to finish.
+func (t *TencentSSLCertificate) RollbackDeployment(client SSLClient, record CertificateDeployRecord) RollbackResult {
+	result := RollbackResult{
+		FailedCertificateID:   record.CertID,
+		RestoredCertificateID: record.OldCertID,
+		ResourceTypes:         record.ResourceTypes,
+	}
+
+	var resourceTypesRegions []*sslCertificate.ResourceTypeRegions
+	for _, value := range t.CertificateResourceTypes {
+		if !containsString(record.ResourceTypes, value.Name) {
+			continue
+		}
+
+		resourceTypesRegions = append(resourceTypesRegions, &sslCertificate.ResourceTypeRegions{
+			ResourceType: common.StringPtr(value.Name),
+			Regions:      common.StringPtrs(value.Regions),
+		})
+
+		for _, region := range value.Regions {
+			if !containsString(result.Regions, region) {
+				result.Regions = append(result.Regions, region)
+			}
+		}
+	}
+
+	logger.Logger.Info(fmt.Sprintf("rolling back certificate %s to %s for resource types %v", record.CertID, record.OldCertID, record.ResourceTypes))
+
+	// the new certificate is the "old" one of this update, so resources that
+	// already switched move back to the previous certificate
+	request := sslCertificate.NewUpdateCertificateInstanceRequest()
+	request.OldCertificateId = common.StringPtr(record.CertID)
+	request.CertificateId = common.StringPtr(record.OldCertID)
+	request.ResourceTypes = common.StringPtrs(record.ResourceTypes)
+	request.ResourceTypesRegions = resourceTypesRegions
+	request.ExpiringNotificationSwitch = common.Uint64Ptr(0)
+
+	var response *sslCertificate.UpdateCertificateInstanceResponse
+	err := withMutationRetry(t.Context, "UpdateCertificateInstance", func() error {
+		if err := waitRateLimit(t.Context, "UpdateCertificateInstance"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.UpdateCertificateInstanceWithContext(t.Context, request)
+		t.audit(audit.Event{
+			Action:           "UpdateCertificateInstance",
+			CertificateID:    record.OldCertID,
+			OldCertificateID: record.CertID,
+			Resources:        record.ResourceTypes,
+		}, response, err)
+		return err
+	})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to roll back certificate %s with error: %s", record.CertID, err)
+		return result
+	}
+
+	deployment, err := parseUpdateCertificateInstance(response)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid response while rolling back certificate %s with error: %s", record.CertID, err)
+		return result
+	}
+	result.DeployRecordID = deployment.DeployRecordID
+
+	for attempt := 0; attempt < rollbackPollAttempts; attempt++ {
+		select {
+		case <-t.Context.Done():
+			result.Error = fmt.Sprintf("rollback of certificate %s was interrupted", record.CertID)
+			return result
+		case <-time.After(rollbackPollInterval):
+		}
+
+		records, err := t.DescribeUpdateRecords(client, record.CertID)
+		if err != nil {
+			logger.Logger.Info(fmt.Sprintf("unable to get rollback status of certificate %s with error: %s", record.CertID, err))
+			continue
+		}
+
+		for _, item := range filterDeployRecords(records, deployment.DeployRecordID) {
+			switch {
+			case item.Status == DeployStatusSuccess:
+				logger.Logger.Info(fmt.Sprintf("rollback of certificate %s to %s is completed", record.CertID, record.OldCertID))
+				result.Succeeded = true
+				return result
+			case item.Status.Failed():
+				result.Error = fmt.Sprintf("rollback deployment %d of certificate %s failed", deployment.DeployRecordID, record.CertID)
+				return result
+			}
+		}
+	}
+
+	result.Error = fmt.Sprintf("rollback deployment %d of certificate %s did not finish in time", deployment.DeployRecordID, record.CertID)
+	return result
+}
+
+func parseUpdateCertificateInstance(response *sslCertificate.UpdateCertificateInstanceResponse) (certificateDeployment, error) {
+	var deployment certificateDeployment
+
+	data, err := json.Marshal(response.Response)
+	if err != nil {
+		return deployment, err
+	}
+
+	err = json.Unmarshal(data, &deployment)
+	if err != nil {
+		return deployment, err
+	}
+
+	return deployment, nil
+}
+
+func filterDeployRecords(records []CertificateDeployRecord, recordID int) []CertificateDeployRecord {
+	var filtered []CertificateDeployRecord
+	for _, record := range records {
+		if record.ID == recordID {
+			filtered = append(filtered, record)
+		}
+	}
+
+	return filtered
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
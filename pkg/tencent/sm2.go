@@ -0,0 +1,218 @@
+package tencent
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// crypto/x509 rejects certificates and keys on the SM2 curve of the Chinese
+// national standards (GM/T 0003), so they are read with encoding/asn1 here.
+// Only what fingerprinting and key matching need is parsed, signatures are
+// not verified.
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveSM2       = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+)
+
+var (
+	sm2Once  sync.Once
+	sm2Curve *elliptic.CurveParams
+)
+
+// sm2P256 returns the SM2 curve. Its a coefficient is p - 3, so the generic
+// CurveParams arithmetic applies.
+func sm2P256() *elliptic.CurveParams {
+	sm2Once.Do(func() {
+		sm2Curve = &elliptic.CurveParams{Name: "SM2-P-256", BitSize: 256}
+		sm2Curve.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+		sm2Curve.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+		sm2Curve.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+		sm2Curve.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+		sm2Curve.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+	})
+
+	return sm2Curve
+}
+
+type sm2Certificate struct {
+	TBSCertificate sm2TBSCertificate
+}
+
+// sm2TBSCertificate stops at the subject public key info, asn1 ignores the
+// trailing fields of a sequence.
+type sm2TBSCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// IsSM2Certificate reports whether the leaf of a PEM encoded chain holds an
+// SM2 public key.
+func IsSM2Certificate(certPEM []byte) bool {
+	der, err := leafCertificateDER(certPEM)
+	if err != nil {
+		return false
+	}
+
+	_, _, err = parseSM2Certificate(der)
+
+	return err == nil
+}
+
+// parseSM2Certificate returns the serial number and raw subject public key
+// info of a certificate with an SM2 public key.
+func parseSM2Certificate(der []byte) (*big.Int, []byte, error) {
+	var cert sm2Certificate
+	if _, err := asn1.Unmarshal(der, &cert); err != nil {
+		return nil, nil, err
+	}
+
+	publicKeyInfo := cert.TBSCertificate.PublicKey.FullBytes
+	if _, err := sm2PublicKey(publicKeyInfo); err != nil {
+		return nil, nil, err
+	}
+
+	return cert.TBSCertificate.SerialNumber, publicKeyInfo, nil
+}
+
+// sm2PublicKey returns the uncompressed point of an SM2 subject public key
+// info.
+func sm2PublicKey(publicKeyInfo []byte) ([]byte, error) {
+	var info subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(publicKeyInfo, &info); err != nil {
+		return nil, err
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) && !info.Algorithm.Algorithm.Equal(oidCurveSM2) {
+		return nil, errors.New("public key is not an sm2 key")
+	}
+
+	if info.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidCurveSM2) {
+			return nil, errors.New("public key is not an sm2 key")
+		}
+	}
+
+	return info.PublicKey.RightAlign(), nil
+}
+
+// parseSM2PrivateKey returns the uncompressed public point of a PKCS#8 or
+// SEC 1 encoded SM2 private key.
+func parseSM2PrivateKey(der []byte) ([]byte, error) {
+	var curve asn1.ObjectIdentifier
+	keyDER := der
+
+	var pkcs8 pkcs8PrivateKey
+	if _, err := asn1.Unmarshal(der, &pkcs8); err == nil && len(pkcs8.Algorithm.Algorithm) > 0 {
+		switch {
+		case pkcs8.Algorithm.Algorithm.Equal(oidCurveSM2):
+			curve = oidCurveSM2
+		case pkcs8.Algorithm.Algorithm.Equal(oidPublicKeyECDSA):
+			if _, err := asn1.Unmarshal(pkcs8.Algorithm.Parameters.FullBytes, &curve); err != nil {
+				return nil, fmt.Errorf("invalid pkcs#8 ec key parameters: %s", err)
+			}
+		default:
+			return nil, errors.New("private key is not an sm2 key")
+		}
+
+		keyDER = pkcs8.PrivateKey
+	}
+
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(keyDER, &key); err != nil {
+		return nil, fmt.Errorf("invalid ec private key: %s", err)
+	}
+
+	if len(key.NamedCurveOID) > 0 {
+		curve = key.NamedCurveOID
+	}
+
+	if !curve.Equal(oidCurveSM2) {
+		return nil, errors.New("private key is not an sm2 key")
+	}
+
+	params := sm2P256()
+
+	d := new(big.Int).SetBytes(key.PrivateKey)
+	if d.Sign() <= 0 || d.Cmp(params.N) >= 0 {
+		return nil, errors.New("invalid sm2 private key")
+	}
+
+	x, y := params.ScalarBaseMult(d.Bytes())
+
+	return elliptic.Marshal(params, x, y), nil
+}
+
+// sm2PrivateKeyMatches reports whether an SM2 private key belongs to the
+// subject public key info of a certificate.
+func sm2PrivateKeyMatches(publicKeyInfo []byte, der []byte) (bool, error) {
+	point, err := parseSM2PrivateKey(der)
+	if err != nil {
+		return false, err
+	}
+
+	publicKey, err := sm2PublicKey(publicKeyInfo)
+	if err != nil {
+		return false, nil
+	}
+
+	return bytes.Equal(point, publicKey), nil
+}
+
+// encryptionKeyPair decodes the encryption certificate and private key of an
+// SM2 certificate, both are empty for other certificates.
+func (t *TencentSSLCertificate) encryptionKeyPair() (string, string, error) {
+	if t.EncryptCertificate == "" && t.EncryptPrivateKey == "" {
+		return "", "", nil
+	}
+
+	if t.EncryptCertificate == "" || t.EncryptPrivateKey == "" {
+		err := fmt.Errorf("sm2 certificate %s needs both an encryption certificate and key", t.CertificateName)
+		return "", "", err
+	}
+
+	encryptCert, err := base64.StdEncoding.DecodeString(t.EncryptCertificate)
+	if err != nil {
+		err := fmt.Errorf("unable to decode encryption certificate for certificate")
+		return "", "", err
+	}
+
+	encryptPrivateKey, err := base64.StdEncoding.DecodeString(t.EncryptPrivateKey)
+	if err != nil {
+		err := fmt.Errorf("unable to decode encryption private key for certificate")
+		return "", "", err
+	}
+
+	return string(encryptCert), string(encryptPrivateKey), nil
+}
@@ -4,127 +4,357 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/fredytarigan/Tendo/pkg/tendo/audit"
 	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
 	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
 	tencentCloudSDKError "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/errors"
-	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common/profile"
 
 	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
 )
 
+// SSLClient is the part of the Tencent SSL API used by tendo. It is
+// satisfied by *sslCertificate.Client and by fake.SSLClient.
+type SSLClient interface {
+	DescribeCertificatesWithContext(ctx context.Context, request *sslCertificate.DescribeCertificatesRequest) (*sslCertificate.DescribeCertificatesResponse, error)
+	DescribeCertificateDetailWithContext(ctx context.Context, request *sslCertificate.DescribeCertificateDetailRequest) (*sslCertificate.DescribeCertificateDetailResponse, error)
+	UploadCertificateWithContext(ctx context.Context, request *sslCertificate.UploadCertificateRequest) (*sslCertificate.UploadCertificateResponse, error)
+	UpdateCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.UpdateCertificateInstanceRequest) (*sslCertificate.UpdateCertificateInstanceResponse, error)
+	DescribeHostUpdateRecordWithContext(ctx context.Context, request *sslCertificate.DescribeHostUpdateRecordRequest) (*sslCertificate.DescribeHostUpdateRecordResponse, error)
+	DeleteCertificateWithContext(ctx context.Context, request *sslCertificate.DeleteCertificateRequest) (*sslCertificate.DeleteCertificateResponse, error)
+	ModifyCertificateAliasWithContext(ctx context.Context, request *sslCertificate.ModifyCertificateAliasRequest) (*sslCertificate.ModifyCertificateAliasResponse, error)
+	DeployCertificateInstanceWithContext(ctx context.Context, request *sslCertificate.DeployCertificateInstanceRequest) (*sslCertificate.DeployCertificateInstanceResponse, error)
+	DescribeHostDeployRecordDetailWithContext(ctx context.Context, request *sslCertificate.DescribeHostDeployRecordDetailRequest) (*sslCertificate.DescribeHostDeployRecordDetailResponse, error)
+}
+
+// Certificate statuses reported by DescribeCertificates which Tendo lists.
+const (
+	CertificateStatusIssued  = 1
+	CertificateStatusExpired = 3
+)
+
+// Ways to find an existing certificate when no certificate ID is configured.
+const (
+	MatchByAlias  = "alias"
+	MatchByDomain = "domain"
+)
+
+// DescribeCertificates page size used when listing certificates.
+const certificatePageSize = 100
+
+// certificateTimeLayout is the layout of times returned by the SSL API, in
+// the Beijing time zone.
+const certificateTimeLayout = "2006-01-02 15:04:05"
+
+// deployPollInterval is the time between two reads of the deploy records of
+// a running certificate update, deployWatchTimeout how long they are read
+// before the update is given up on.
+var (
+	deployPollInterval = 5 * time.Second
+	deployWatchTimeout = 30 * time.Minute
+)
+
+// SSLClientFactory, when set, replaces the SDK client built by BuildClient.
+// It lets tests run the watcher against fake.SSLClient.
+var SSLClientFactory func(t *TencentSSLCertificate) (SSLClient, error)
+
 type TencentSSLCertificate struct {
-	Context 					context.Context
-	Credentials 			 	common.CredentialIface
-	Region 						string
-	CertificateID 	 			 string
-	CertificateName  			 string
-	CertificateResourceTypes	 []CertificateResourceType
-	PublicKey					string
-	PrivateKey					string
+	Context                  context.Context
+	Account                  string
+	Target                   string
+	Credentials              common.CredentialIface
+	Region                   string
+	ClientOptions            ClientOptions
+	CertificateID            string
+	CertificateName          string
+	CertificateDomain        string
+	MatchBy                  string
+	CertificateResourceTypes []CertificateResourceType
+	CertificateInstances     []CertificateInstance
+	CLBListeners             []CLBListener
+	PublicKey                string
+	PrivateKey               string
+	CACertificate            string
+	CACertificateID          string
+	EncryptCertificate       string
+	EncryptPrivateKey        string
+	DeployRecordID           int
+	Deployment               DeploymentSummary
+	Retention                RetentionPolicy
+	Tags                     map[string]string
 }
 
 type CertificateResourceType struct {
-	Name 		string		`mapstructure:"name"`
-	Regions 	[]string	`mapstructure:"regions"`
+	Name    string   `mapstructure:"name"`
+	Regions []string `mapstructure:"regions"`
 }
 
 type CertificateData struct {
-	CertificateID	string	`mapstructure:"CertificateID"`
+	CertificateID   string   `json:"CertificateId"`
+	Alias           string   `json:"Alias"`
+	CertificateType string   `json:"CertificateType"`
+	CertEndTime     string   `json:"CertEndTime"`
+	Domain          string   `json:"Domain"`
+	SubjectAltName  []string `json:"SubjectAltName"`
+	Status          uint64   `json:"Status"`
+	Tags            []Tag    `json:"Tags"`
+	BoundResource   []string `json:"BoundResource"`
 }
 
+// CertificateDetail deliberately has no private key field, tendo compares
+// certificates by fingerprint. Only pull targets read the key stored in
+// tencent cloud, see DownloadCertificate.
 type CertificateDetail struct {
-	CertificatePublicKey	string	`mapstructure:"CertificatePublicKey"`
-	CertificatePrivateKey	string	`mapstructure:"CertificatePrivateKey"`
+	CertificatePublicKey string                 `json:"CertificatePublicKey"`
+	EncryptCert          string                 `json:"EncryptCert"`
+	Fingerprint          CertificateFingerprint `json:"-"`
+	EncryptFingerprint   CertificateFingerprint `json:"-"`
 }
 
 type CertificateNotFoundError struct {
 	Message string
 }
 
+type CertificateAmbiguousError struct {
+	Message        string
+	CertificateIDs []string
+}
+
 type CertifiateUpdateStatus struct {
-	TotalCount			int								`json:"TotalCount"`
-	DeployRecordLists 	[]CertificateDeployRecord		 `json:"DeployRecordList"`
-	RequestID 			string 							`json:"RequestId"`
+	TotalCount        int                       `json:"TotalCount"`
+	DeployRecordLists []CertificateDeployRecord `json:"DeployRecordList"`
+	RequestID         string                    `json:"RequestId"`
 }
 
 type CertificateDeployRecord struct {
-	ID 				int			`json:"Id"`
-	CertID 			string 		`json:"CertId"`
-	OldCertID 		string 		`json:"OldCertId"`
-	ResourceTypes 	[]string 	`json:"ResourceTypes"`
-	Status 			int 		`json:"Status"`
-	CreateTime 		string 		`json:"CreateTime"`
-	UpdateTime 		string 		`json:"UpdateTime"`
+	ID            int          `json:"Id"`
+	CertID        string       `json:"CertId"`
+	OldCertID     string       `json:"OldCertId"`
+	ResourceTypes []string     `json:"ResourceTypes"`
+	Regions       []string     `json:"Regions"`
+	Status        DeployStatus `json:"Status"`
+	CreateTime    string       `json:"CreateTime"`
+	UpdateTime    string       `json:"UpdateTime"`
 }
 
 func (e *CertificateNotFoundError) Error() string {
 	return e.Message
 }
 
-func (t *TencentSSLCertificate) BuildClient() (*sslCertificate.Client, error) {
-	var client *sslCertificate.Client
+func (e *CertificateAmbiguousError) Error() string {
+	return e.Message
+}
+
+// MatchesDomain reports whether the certificate is issued for domain, either
+// as its main domain or as one of its subject alternative names.
+func (c CertificateData) MatchesDomain(domain string) bool {
+	if strings.EqualFold(c.Domain, domain) {
+		return true
+	}
 
-	profile := profile.NewClientProfile()
-	profile.HttpProfile.Endpoint = "ssl.tencentcloudapi.com"
+	for _, name := range c.SubjectAltName {
+		if strings.EqualFold(name, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *TencentSSLCertificate) BuildClient() (SSLClient, error) {
+	if SSLClientFactory != nil {
+		return SSLClientFactory(t)
+	}
+
+	profile := t.ClientOptions.profile("ssl", t.ClientOptions.Endpoint)
 
 	client, err := sslCertificate.NewClient(t.Credentials, t.Region, profile)
 	if err != nil {
 		err := fmt.Errorf("unable to build tencent cloud ssl certificate client with error: %s", err)
-		return client, err
+		return nil, err
+	}
+
+	transport, err := t.ClientOptions.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	if transport != nil {
+		client.WithHttpTransport(transport)
 	}
 
 	return client, nil
 }
 
-func (t *TencentSSLCertificate) GetCertificateID(client *sslCertificate.Client) (string, error) {
-	var certData []CertificateData
+func (t *TencentSSLCertificate) GetCertificateID(client SSLClient) (string, error) {
+	// look up certificates uploaded by tendo for this target first, then
+	// fall back to untagged certificates uploaded before tagging existed
+	matched, err := t.findCertificates(client, t.Tags)
+	if err != nil {
+		return "", err
+	}
 
-	// build request
-	request := sslCertificate.NewDescribeCertificatesRequest()
-	request.Limit = common.Uint64Ptr(1)
+	if len(matched) < 1 && len(t.Tags) > 0 {
+		candidates, err := t.findCertificates(client, nil)
+		if err != nil {
+			return "", err
+		}
 
-	request.SearchKey = &t.CertificateName
-	request.CertificateStatus = common.Uint64Ptrs([]uint64{1})
+		// certificates tagged by tendo belong to another target
+		for _, cert := range candidates {
+			if cert.TagMap()[TagManagedBy] != ManagedByTendo {
+				matched = append(matched, cert)
+			}
+		}
 
-	response, err := client.DescribeCertificatesWithContext(t.Context, request)
-	if err != nil {
-		return "", err
+		if len(matched) > 0 {
+			logger.Logger.Info(fmt.Sprintf("certificate %s is not tagged by tendo, it will be tagged on its next update", t.CertificateName))
+		}
 	}
 
-	if *response.Response.TotalCount < 1 {
+	if len(matched) < 1 {
 		msg := fmt.Sprintf("certificate with name or id %s not found", t.CertificateName)
-		err := fmt.Errorf("%w", &CertificateNotFoundError {
+		err := fmt.Errorf("%w", &CertificateNotFoundError{
 			Message: msg,
 		})
 		return "", err
 	}
 
-	cert, err := json.Marshal(response.Response.Certificates)
-	if err != nil {
-		err := fmt.Errorf("invalid response while getting certificate with error: %s", err)
+	if len(matched) > 1 {
+		var certIDs []string
+		for _, cert := range matched {
+			certIDs = append(certIDs, cert.CertificateID)
+		}
+
+		msg := fmt.Sprintf("certificate with name %s is ambiguous, %d certificates match: %s", t.CertificateName, len(matched), strings.Join(certIDs, ", "))
+		err := fmt.Errorf("%w", &CertificateAmbiguousError{
+			Message:        msg,
+			CertificateIDs: certIDs,
+		})
 		return "", err
 	}
 
-	err = json.Unmarshal([]byte(cert), &certData)
-	if err != nil {
-		err := fmt.Errorf("unable to parse certificates response with error: %s", err)
-		return "", err
+	return matched[0].CertificateID, nil
+}
+
+// findCertificates lists the certificates matching the target by alias or
+// domain, restricted to certificates carrying all of tags.
+func (t *TencentSSLCertificate) findCertificates(client SSLClient, tags map[string]string) ([]CertificateData, error) {
+	var matched []CertificateData
+
+	switch t.MatchBy {
+	case "", MatchByAlias:
+		certificates, err := t.ListCertificates(client, t.CertificateName, tags)
+		if err != nil {
+			return matched, err
+		}
+
+		// SearchKey is a fuzzy match, so only keep exact alias matches
+		for _, cert := range certificates {
+			if cert.Alias == t.CertificateName {
+				matched = append(matched, cert)
+			}
+		}
+
+	case MatchByDomain:
+		if t.CertificateDomain == "" {
+			err := fmt.Errorf("certificate domain is required to look up certificate %s by domain", t.CertificateName)
+			return matched, err
+		}
+
+		certificates, err := t.ListCertificates(client, t.CertificateDomain, tags)
+		if err != nil {
+			return matched, err
+		}
+
+		for _, cert := range certificates {
+			if cert.MatchesDomain(t.CertificateDomain) {
+				matched = append(matched, cert)
+			}
+		}
+
+	default:
+		err := fmt.Errorf("unsupported certificate match %s for certificate %s", t.MatchBy, t.CertificateName)
+		return matched, err
 	}
 
-	return certData[0].CertificateID, nil
+	return matched, nil
 }
 
-func (t *TencentSSLCertificate) GetCertificateDetail(client *sslCertificate.Client) (CertificateDetail, error)  {
+// ListCertificates pages through all issued certificates matching searchKey
+// and carrying all of tags.
+func (t *TencentSSLCertificate) ListCertificates(client SSLClient, searchKey string, tags map[string]string) ([]CertificateData, error) {
+	return t.listCertificates(client, searchKey, tags, []uint64{CertificateStatusIssued})
+}
+
+func (t *TencentSSLCertificate) listCertificates(client SSLClient, searchKey string, tags map[string]string, statuses []uint64) ([]CertificateData, error) {
+	var certData []CertificateData
+
+	for offset := uint64(0); ; {
+		// build request
+		request := sslCertificate.NewDescribeCertificatesRequest()
+		request.Offset = common.Uint64Ptr(offset)
+		request.Limit = common.Uint64Ptr(certificatePageSize)
+		request.CertificateStatus = common.Uint64Ptrs(statuses)
+
+		if searchKey != "" {
+			request.SearchKey = common.StringPtr(searchKey)
+		}
+
+		if len(tags) > 0 {
+			request.Tags = sslTags(tags)
+		}
+
+		if err := waitRateLimit(t.Context, "DescribeCertificates"); err != nil {
+			return certData, err
+		}
+
+		response, err := client.DescribeCertificatesWithContext(t.Context, request)
+		if err != nil {
+			return certData, err
+		}
+
+		cert, err := json.Marshal(response.Response.Certificates)
+		if err != nil {
+			err := fmt.Errorf("invalid response while getting certificate with error: %s", err)
+			return certData, err
+		}
+
+		var page []CertificateData
+		err = json.Unmarshal([]byte(cert), &page)
+		if err != nil {
+			err := fmt.Errorf("unable to parse certificates response with error: %s", err)
+			return certData, err
+		}
+
+		certData = append(certData, page...)
+		offset += uint64(len(page))
+
+		if len(page) == 0 || response.Response.TotalCount == nil || offset >= *response.Response.TotalCount {
+			break
+		}
+	}
+
+	return certData, nil
+}
+
+func (t *TencentSSLCertificate) GetCertificateDetail(client SSLClient) (CertificateDetail, error) {
+	return t.DescribeCertificateDetail(client, t.CertificateID)
+}
+
+func (t *TencentSSLCertificate) DescribeCertificateDetail(client SSLClient, certID string) (CertificateDetail, error) {
 	var certDetail CertificateDetail
 
 	// build request
 	request := sslCertificate.NewDescribeCertificateDetailRequest()
-	request.CertificateId = &t.CertificateID
+	request.CertificateId = common.StringPtr(certID)
+
+	if err := waitRateLimit(t.Context, "DescribeCertificateDetail"); err != nil {
+		return certDetail, err
+	}
 
 	response, err := client.DescribeCertificateDetailWithContext(t.Context, request)
 	if err != nil {
@@ -133,7 +363,7 @@ func (t *TencentSSLCertificate) GetCertificateDetail(client *sslCertificate.Clie
 
 	cert, err := json.Marshal(response.Response)
 	if err != nil {
-		err := fmt.Errorf("invalid response while getting certificate id %s detail with error: %s", t.CertificateID, err)
+		err := fmt.Errorf("invalid response while getting certificate id %s detail with error: %s", certID, err)
 		return certDetail, err
 	}
 
@@ -143,47 +373,36 @@ func (t *TencentSSLCertificate) GetCertificateDetail(client *sslCertificate.Clie
 		return certDetail, err
 	}
 
-	certDetail.CertificatePublicKey = base64.StdEncoding.EncodeToString([]byte(certDetail.CertificatePublicKey))
-	certDetail.CertificatePrivateKey = base64.StdEncoding.EncodeToString([]byte(certDetail.CertificatePrivateKey))
-
-	return certDetail, nil
-}
-
-func (t *TencentSSLCertificate) GetCertificateData(client *sslCertificate.Client) (CertificateDetail, error) {
-	var certDetail CertificateDetail
+	fingerprint, err := ParseCertificateFingerprint([]byte(certDetail.CertificatePublicKey))
+	if err != nil {
+		err := fmt.Errorf("unable to fingerprint certificate id %s with error: %s", certID, err)
+		return certDetail, err
+	}
 
+	certDetail.Fingerprint = fingerprint
 
-	// get certificate id
-	if t.CertificateID == "" {
-		var certificateID string
-		certificateID, err := t.GetCertificateID(client)
+	// sm2 certificates carry a second certificate for encryption
+	if certDetail.EncryptCert != "" {
+		encryptFingerprint, err := ParseCertificateFingerprint([]byte(certDetail.EncryptCert))
 		if err != nil {
-			certNotFoundError := &CertificateNotFoundError{}
-			if errors.As(err, &certNotFoundError) {
-				logger.Logger.Info(fmt.Sprintf("certificate with name %s not found", t.CertificateName))
-				logger.Logger.Info(fmt.Sprintf("will create a new certificate in tencent cloud with name %s", t.CertificateName))
-
-				certificateID, err = t.CreateCertificate(client)
-				if err != nil {
-					return certDetail, err
-				}
-			} else {
-				return certDetail, err
-			}
+			err := fmt.Errorf("unable to fingerprint encryption certificate of certificate id %s with error: %s", certID, err)
+			return certDetail, err
 		}
 
-		t.CertificateID = certificateID
-	}
-
-	certDetail, err := t.GetCertificateDetail(client)
-	if err != nil {
-		return certDetail, err
+		certDetail.EncryptFingerprint = encryptFingerprint
 	}
+	certDetail.CertificatePublicKey = base64.StdEncoding.EncodeToString([]byte(certDetail.CertificatePublicKey))
 
 	return certDetail, nil
 }
 
-func (t *TencentSSLCertificate) CreateCertificate(client *sslCertificate.Client) (string, error) {
+func (t *TencentSSLCertificate) CreateCertificate(client SSLClient) (string, error) {
+	return t.uploadCertificate(client, t.CertificateName)
+}
+
+// uploadCertificate uploads the secret certificate as a new certificate
+// with alias.
+func (t *TencentSSLCertificate) uploadCertificate(client SSLClient, alias string) (string, error) {
 	var certData CertificateData
 
 	publicKeyByte, err := base64.StdEncoding.DecodeString(t.PublicKey)
@@ -200,7 +419,6 @@ func (t *TencentSSLCertificate) CreateCertificate(client *sslCertificate.Client)
 	}
 	privateKeyString := string(privateKeyByte)
 
-
 	// build request
 	repeatable := new(bool)
 	*repeatable = true
@@ -208,17 +426,33 @@ func (t *TencentSSLCertificate) CreateCertificate(client *sslCertificate.Client)
 	request := sslCertificate.NewUploadCertificateRequest()
 	request.CertificatePublicKey = &publicKeyString
 	request.CertificatePrivateKey = &privateKeyString
-	request.Alias = &t.CertificateName
+	request.Alias = &alias
 	request.Repeatable = repeatable
+	request.Tags = sslTags(t.Tags)
+
+	encryptCert, encryptPrivateKey, err := t.encryptionKeyPair()
+	if err != nil {
+		return "", err
+	}
+
+	if encryptCert != "" {
+		request.EncryptCert = common.StringPtr(encryptCert)
+		request.EncryptPrivateKey = common.StringPtr(encryptPrivateKey)
+	}
+
+	if err := waitRateLimit(t.Context, "UploadCertificate"); err != nil {
+		return "", err
+	}
 
 	response, err := client.UploadCertificateWithContext(t.Context, request)
 	if err != nil {
+		t.audit(audit.Event{Action: "UploadCertificate", Alias: alias}, nil, err)
 		return "", err
 	}
 
 	cert, err := json.Marshal(response.Response)
 	if err != nil {
-		err := fmt.Errorf("invalid response while creating certificate with name %s with error: %s", t.CertificateName, err)
+		err := fmt.Errorf("invalid response while creating certificate with name %s with error: %s", alias, err)
 		return "", err
 	}
 
@@ -228,10 +462,12 @@ func (t *TencentSSLCertificate) CreateCertificate(client *sslCertificate.Client)
 		return "", err
 	}
 
+	t.audit(audit.Event{Action: "UploadCertificate", CertificateID: certData.CertificateID, Alias: alias}, response, nil)
+
 	return certData.CertificateID, nil
 }
 
-func (t *TencentSSLCertificate) UpdateCertificateDetail(client *sslCertificate.Client) error {
+func (t *TencentSSLCertificate) UpdateCertificateDetail(client SSLClient) error {
 	publicKeyByte, err := base64.StdEncoding.DecodeString(t.PublicKey)
 	if err != nil {
 		err := fmt.Errorf("unable to decode public key for certificate")
@@ -253,9 +489,9 @@ func (t *TencentSSLCertificate) UpdateCertificateDetail(client *sslCertificate.C
 
 	var resourceTypesRegions []*sslCertificate.ResourceTypeRegions
 	for _, value := range t.CertificateResourceTypes {
-		result := sslCertificate.ResourceTypeRegions {
+		result := sslCertificate.ResourceTypeRegions{
 			ResourceType: common.StringPtr(value.Name),
-			Regions: common.StringPtrs(value.Regions),
+			Regions:      common.StringPtrs(value.Regions),
 		}
 
 		resourceTypesRegions = append(resourceTypesRegions, &result)
@@ -271,103 +507,191 @@ func (t *TencentSSLCertificate) UpdateCertificateDetail(client *sslCertificate.C
 	request.ResourceTypesRegions = resourceTypesRegions
 	request.Repeatable = common.BoolPtr(true)
 	request.AllowDownload = common.BoolPtr(true)
+	request.Tags = sslTags(t.Tags)
 	request.ExpiringNotificationSwitch = common.Uint64Ptr(0)
 
-	response, err := client.UpdateCertificateInstanceWithContext(t.Context, request)
-	if _, ok := err.(*tencentCloudSDKError.TencentCloudSDKError); ok {
-		err := fmt.Errorf("failed to update certificate %s with error: %s", t.CertificateName, err)
+	encryptCert, encryptPrivateKey, err := t.encryptionKeyPair()
+	if err != nil {
 		return err
 	}
 
+	if encryptCert != "" {
+		request.EncryptCert = common.StringPtr(encryptCert)
+		request.EncryptPrivateKey = common.StringPtr(encryptPrivateKey)
+	}
+
+	// the id of the uploaded certificate is only known from the deploy
+	// records, auditDeployment records it once the deployment finished
+	var response *sslCertificate.UpdateCertificateInstanceResponse
+	err = withMutationRetry(t.Context, "UpdateCertificateInstance", func() error {
+		if err := waitRateLimit(t.Context, "UpdateCertificateInstance"); err != nil {
+			return err
+		}
+
+		var err error
+		response, err = client.UpdateCertificateInstanceWithContext(t.Context, request)
+		t.audit(audit.Event{
+			Action:           "UpdateCertificateInstance",
+			OldCertificateID: t.CertificateID,
+			Resources:        resourceTypes,
+		}, response, err)
+		return err
+	})
 	if err != nil {
-		err := fmt.Errorf("failed to update certificate %s with error: %s", t.CertificateName, err)
+		err := fmt.Errorf("failed to update certificate %s with error: %w", t.CertificateName, err)
 		return err
 	}
 
-	_, err = json.Marshal(response.Response)
+	deployment, err := parseUpdateCertificateInstance(response)
 	if err != nil {
 		err := fmt.Errorf("invalid response while updating certificate with name %s with error: %s", t.CertificateName, err)
 		return err
 	}
 
+	// only track the deploy record of this update, older records of the
+	// same certificate may still be listed
+	t.DeployRecordID = deployment.DeployRecordID
+
 	return nil
 }
 
-func (t *TencentSSLCertificate) WatchCertificateUpdateStatus(client *sslCertificate.Client) (string, error) {
-	updateFinished := false
+func (t *TencentSSLCertificate) WatchCertificateUpdateStatus(client SSLClient) (string, error) {
+	deadline := time.After(deployWatchTimeout)
 
-	for !updateFinished {
-		certDeployRecordList, err := t.DescribeCertificateUpdateStatus(client)
+	for {
+		summary, err := t.TrackDeployment(client)
 		if err != nil {
 			return "", err
 		}
+		t.Deployment = summary
 
-		var wg sync.WaitGroup
-		status := []int{}
-
-		for _, item := range certDeployRecordList {
+		if summary.Total() == 0 {
+			logger.Logger.Info("Deploy record is not available yet, so we are waiting for it")
+		} else {
+			logger.Logger.Info(fmt.Sprintf("deployment of certificate %s: %s", t.CertificateName, summary))
+		}
 
-			logger.Logger.Info("Checking for certificate deployment status")
+		// a failed record leaves resources on mixed certificates, move them
+		// back to the previous certificate and keep it instead of deleting it.
+		// records still running are waited for first, so they can be rolled
+		// back as well.
+		if summary.Done() {
+			t.auditDeployment(summary)
+		}
 
-			wg.Add(1)
+		if summary.Done() && len(summary.Failed) > 0 {
+			logger.Logger.Error(fmt.Sprintf("deployment of certificate %s failed, rolling back to the previous certificate", t.CertificateName))
+
+			// a new slice, appending to summary.Failed could overwrite the
+			// records it shares its array with
+			records := make([]CertificateDeployRecord, 0, len(summary.Failed)+len(summary.Succeeded))
+			records = append(records, summary.Failed...)
+			records = append(records, summary.Succeeded...)
+
+			var rollbacks []RollbackResult
+			for _, item := range records {
+				// tencent cloud moved these resources back on its own
+				if item.Status == DeployStatusRollbackSucceeded {
+					rollbacks = append(rollbacks, RollbackResult{
+						FailedCertificateID:   item.CertID,
+						RestoredCertificateID: item.OldCertID,
+						ResourceTypes:         item.ResourceTypes,
+						Regions:               item.Regions,
+						DeployRecordID:        item.ID,
+						Succeeded:             true,
+					})
+					continue
+				}
 
-			go func(item CertificateDeployRecord) {
-				defer wg.Done()
+				rollbacks = append(rollbacks, t.RollbackDeployment(client, item))
+			}
 
-				status = append(status, item.Status)
-			}(item)
+			err := &DeploymentFailedError{
+				Message:   fmt.Sprintf("deployment of certificate %s failed for %d of %d deploy records", t.CertificateName, len(summary.Failed), len(records)),
+				Records:   summary.Failed,
+				Rollbacks: rollbacks,
+				Summary:   summary,
+			}
+			return "", err
 		}
 
-		wg.Wait()
-
-		if allStatusIsDone(status) {
+		if summary.Done() {
 			logger.Logger.Info("All deployment is completed")
 
-			for _, item := range certDeployRecordList {
-				_, err := t.DeleteCertificate(client, item.OldCertID)
+			for _, item := range summary.Succeeded {
+				err := t.RetireCertificate(client, item.OldCertID)
 				if err != nil {
-					fmt.Printf("%s", err)
+					logger.Logger.Error(err.Error())
 					continue
 				}
 
 				_, err = t.ModifyCertificateName(client, item.CertID, t.CertificateName)
 				if err != nil {
-					fmt.Printf("%s", err)
+					logger.Logger.Error(err.Error())
 					continue
 				}
 			}
-			
-			break
+
+			return summary.Succeeded[0].CertID, nil
 		}
 
-		logger.Logger.Info("Not all deployment is finished, so we are waiting for all deployment to completed")
-		time.Sleep(5 * time.Second)
+		select {
+		case <-t.Context.Done():
+			return "", t.Context.Err()
+		case <-deadline:
+			err := fmt.Errorf("deployment of certificate %s did not finish within %s: %s", t.CertificateName, deployWatchTimeout, summary)
+			return "", err
+		case <-time.After(deployPollInterval):
+		}
+	}
+}
+
+// TrackDeployment reads the deploy records of the running certificate
+// update, limited to the record of the last UpdateCertificateDetail call,
+// and summarizes them.
+func (t *TencentSSLCertificate) TrackDeployment(client SSLClient) (DeploymentSummary, error) {
+	records, err := t.DescribeCertificateUpdateStatus(client)
+	if err != nil {
+		return DeploymentSummary{}, err
+	}
+
+	if t.DeployRecordID != 0 {
+		records = filterDeployRecords(records, t.DeployRecordID)
 	}
 
-	return "", nil
+	return SummarizeDeployment(records), nil
+}
+
+func (t *TencentSSLCertificate) DescribeCertificateUpdateStatus(client SSLClient) ([]CertificateDeployRecord, error) {
+	return t.DescribeUpdateRecords(client, t.CertificateID)
 }
 
-func (t *TencentSSLCertificate) DescribeCertificateUpdateStatus(client *sslCertificate.Client) ([]CertificateDeployRecord, error) {
+// DescribeUpdateRecords lists the deploy records that replaced oldCertID.
+func (t *TencentSSLCertificate) DescribeUpdateRecords(client SSLClient, oldCertID string) ([]CertificateDeployRecord, error) {
 	var certificateUpdateStatus CertifiateUpdateStatus
 	var certificateDeployRecord []CertificateDeployRecord
 
 	request := sslCertificate.NewDescribeHostUpdateRecordRequest()
-	request.OldCertificateId = common.StringPtr(t.CertificateID)
+	request.OldCertificateId = common.StringPtr(oldCertID)
 
-	response, err := client.DescribeHostUpdateRecordWithContext(t.Context, request)
-	if _, ok := err.(*tencentCloudSDKError.TencentCloudSDKError); ok {
-		err := fmt.Errorf("failed to get certificate %s update with error: %s", t.CertificateID, err)
-		return certificateDeployRecord, err
-	}
+	var response *sslCertificate.DescribeHostUpdateRecordResponse
+	err := withRetry(t.Context, "DescribeHostUpdateRecord", func() error {
+		if err := waitRateLimit(t.Context, "DescribeHostUpdateRecord"); err != nil {
+			return err
+		}
 
+		var err error
+		response, err = client.DescribeHostUpdateRecordWithContext(t.Context, request)
+		return err
+	})
 	if err != nil {
-		err := fmt.Errorf("failed to get certificate %s update with error: %s", t.CertificateID, err)
+		err := fmt.Errorf("failed to get certificate %s update with error: %w", oldCertID, err)
 		return certificateDeployRecord, err
 	}
 
 	cert, err := json.Marshal(response.Response)
 	if err != nil {
-		err :=  fmt.Errorf("invalid response while getting certificate update with name %s with error: %s", t.CertificateID, err)
+		err := fmt.Errorf("invalid response while getting certificate update with name %s with error: %s", oldCertID, err)
 		return certificateDeployRecord, err
 	}
 
@@ -377,34 +701,25 @@ func (t *TencentSSLCertificate) DescribeCertificateUpdateStatus(client *sslCerti
 		return certificateDeployRecord, err
 	}
 
-	if certificateUpdateStatus.TotalCount > 0 {
-		for _, status := range certificateUpdateStatus.DeployRecordLists {
-			fmt.Printf("Status: %v", status)
-			fmt.Println("")
-		}
-
-		return certificateUpdateStatus.DeployRecordLists, nil
-	} 
-
-	err = fmt.Errorf("certificate update status is not found")
-	return certificateDeployRecord, err
-}
-
-func allStatusIsDone(a []int) bool {
-	for i := 1; i < len(a); i++ {
-		if a[i] != 1 {
-			return false
-		}
+	// the record of an update is listed a while after it started, callers
+	// wait for it until their deadline
+	for _, record := range certificateUpdateStatus.DeployRecordLists {
+		logger.Logger.Debug(fmt.Sprintf("deploy record %d of certificate %s is %s", record.ID, record.CertID, record.Status))
 	}
 
-	return true
+	return certificateUpdateStatus.DeployRecordLists, nil
 }
 
-func (t *TencentSSLCertificate) DeleteCertificate(client *sslCertificate.Client, certID string) (bool, error) {
+func (t *TencentSSLCertificate) DeleteCertificate(client SSLClient, certID string) (bool, error) {
 	request := sslCertificate.NewDeleteCertificateRequest()
 	request.CertificateId = common.StringPtr(certID)
 
-	_, err := client.DeleteCertificateWithContext(t.Context, request)
+	if err := waitRateLimit(t.Context, "DeleteCertificate"); err != nil {
+		return false, err
+	}
+
+	response, err := client.DeleteCertificateWithContext(t.Context, request)
+	t.audit(audit.Event{Action: "DeleteCertificate", CertificateID: certID}, response, err)
 	if _, ok := err.(*tencentCloudSDKError.TencentCloudSDKError); ok {
 		err := fmt.Errorf("failed to remove certificate %s with error: %s", certID, err)
 		return false, err
@@ -418,12 +733,17 @@ func (t *TencentSSLCertificate) DeleteCertificate(client *sslCertificate.Client,
 	return true, nil
 }
 
-func (t *TencentSSLCertificate) ModifyCertificateName(client *sslCertificate.Client, certID string, name string) (bool, error) {
+func (t *TencentSSLCertificate) ModifyCertificateName(client SSLClient, certID string, name string) (bool, error) {
 	request := sslCertificate.NewModifyCertificateAliasRequest()
 	request.CertificateId = common.StringPtr(certID)
 	request.Alias = common.StringPtr(name)
 
-	_, err := client.ModifyCertificateAliasWithContext(t.Context, request)
+	if err := waitRateLimit(t.Context, "ModifyCertificateAlias"); err != nil {
+		return false, err
+	}
+
+	response, err := client.ModifyCertificateAliasWithContext(t.Context, request)
+	t.audit(audit.Event{Action: "ModifyCertificateAlias", CertificateID: certID, Alias: name}, response, err)
 	if _, ok := err.(*tencentCloudSDKError.TencentCloudSDKError); ok {
 		err := fmt.Errorf("failed to change certificate name in id %s with error: %s", certID, err)
 		return false, err
@@ -435,4 +755,4 @@ func (t *TencentSSLCertificate) ModifyCertificateName(client *sslCertificate.Cli
 	}
 
 	return true, nil
-}
\ No newline at end of file
+}
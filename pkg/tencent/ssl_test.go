@@ -0,0 +1,411 @@
+package tencent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	// main configures the logger from config.yaml, tests have none
+	logger.Logger = zap.NewNop()
+
+	os.Exit(m.Run())
+}
+
+// testCertificate returns a self-signed certificate for domain and its
+// private key, both PEM encoded.
+func testCertificate(t *testing.T, domain string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return string(certPEM), string(keyPEM)
+}
+
+// testTarget returns a target named name holding a new key pair for domain,
+// encoded the way the watcher reads it from a secret.
+func testTarget(t *testing.T, name string, domain string) *TencentSSLCertificate {
+	t.Helper()
+
+	certPEM, keyPEM := testCertificate(t, domain)
+
+	return &TencentSSLCertificate{
+		Context:         context.Background(),
+		Target:          "default/tendo/" + name,
+		CertificateName: name,
+		PublicKey:       base64.StdEncoding.EncodeToString([]byte(certPEM)),
+		PrivateKey:      base64.StdEncoding.EncodeToString([]byte(keyPEM)),
+		Tags:            ProvenanceTags("default", "tendo", name),
+	}
+}
+
+// fastPolling shortens the deploy, instance deploy and rollback poll
+// intervals for the duration of the test.
+func fastPolling(t *testing.T) {
+	deployInterval, instanceInterval, rollbackInterval := deployPollInterval, instanceDeployPollInterval, rollbackPollInterval
+	deployPollInterval, instanceDeployPollInterval, rollbackPollInterval = time.Millisecond, time.Millisecond, time.Millisecond
+
+	t.Cleanup(func() {
+		deployPollInterval, instanceDeployPollInterval, rollbackPollInterval = deployInterval, instanceInterval, rollbackInterval
+	})
+}
+
+func TestGetCertificateID(t *testing.T) {
+	client := fake.NewSSLClient()
+	certPEM, keyPEM := testCertificate(t, "app.example.com")
+
+	tagged := client.AddCertificate(fake.Certificate{
+		Alias:      "app",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+		Tags:       ProvenanceTags("default", "tendo", "app"),
+	})
+	client.AddCertificate(fake.Certificate{
+		Alias:      "app",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+	})
+	legacy := client.AddCertificate(fake.Certificate{
+		Alias:      "legacy",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+	})
+	client.AddCertificate(fake.Certificate{
+		Alias:      "shared",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+	})
+	client.AddCertificate(fake.Certificate{
+		Alias:      "shared",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+	})
+	client.AddCertificate(fake.Certificate{
+		Alias:      "other",
+		PublicKey:  certPEM,
+		PrivateKey: keyPEM,
+		Status:     fake.CertificateStatusIssued,
+		Tags:       ProvenanceTags("staging", "tendo", "other"),
+	})
+
+	t.Run("tagged certificate is preferred", func(t *testing.T) {
+		target := testTarget(t, "app", "app.example.com")
+
+		certID, err := target.GetCertificateID(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if certID != tagged {
+			t.Errorf("got certificate %s, want the tagged certificate %s", certID, tagged)
+		}
+	})
+
+	t.Run("untagged certificate is found by alias", func(t *testing.T) {
+		target := testTarget(t, "legacy", "legacy.example.com")
+
+		certID, err := target.GetCertificateID(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if certID != legacy {
+			t.Errorf("got certificate %s, want %s", certID, legacy)
+		}
+	})
+
+	t.Run("certificate of another target is not taken over", func(t *testing.T) {
+		target := testTarget(t, "other", "other.example.com")
+
+		_, err := target.GetCertificateID(client)
+
+		notFound := &CertificateNotFoundError{}
+		if !errors.As(err, &notFound) {
+			t.Errorf("got error %v, want a CertificateNotFoundError", err)
+		}
+	})
+
+	t.Run("missing certificate", func(t *testing.T) {
+		target := testTarget(t, "missing", "missing.example.com")
+
+		_, err := target.GetCertificateID(client)
+
+		notFound := &CertificateNotFoundError{}
+		if !errors.As(err, &notFound) {
+			t.Errorf("got error %v, want a CertificateNotFoundError", err)
+		}
+	})
+
+	t.Run("ambiguous alias", func(t *testing.T) {
+		target := testTarget(t, "shared", "shared.example.com")
+
+		_, err := target.GetCertificateID(client)
+
+		ambiguous := &CertificateAmbiguousError{}
+		if !errors.As(err, &ambiguous) {
+			t.Fatalf("got error %v, want a CertificateAmbiguousError", err)
+		}
+
+		if len(ambiguous.CertificateIDs) != 2 {
+			t.Errorf("got %d ambiguous certificates, want 2", len(ambiguous.CertificateIDs))
+		}
+	})
+}
+
+func TestUpdateCertificateDetail(t *testing.T) {
+	client := fake.NewSSLClient()
+	target := testTarget(t, "app", "app.example.com")
+	target.CertificateResourceTypes = []CertificateResourceType{
+		{Name: "clb", Regions: []string{"ap-singapore"}},
+		{Name: "cdn"},
+	}
+
+	oldPEM, oldKeyPEM := testCertificate(t, "app.example.com")
+	target.CertificateID = client.AddCertificate(fake.Certificate{
+		Alias:      "app",
+		PublicKey:  oldPEM,
+		PrivateKey: oldKeyPEM,
+		Status:     fake.CertificateStatusIssued,
+	})
+
+	err := target.UpdateCertificateDetail(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := client.DeployRecords()
+	if len(records) != 1 {
+		t.Fatalf("got %d deploy records, want 1", len(records))
+	}
+
+	record := records[0]
+	if target.DeployRecordID != int(record.ID) {
+		t.Errorf("got deploy record %d, want %d", target.DeployRecordID, record.ID)
+	}
+
+	if record.OldCertID != target.CertificateID || record.CertID == target.CertificateID {
+		t.Errorf("deploy record replaces %s with %s, want a new certificate replacing %s", record.OldCertID, record.CertID, target.CertificateID)
+	}
+
+	if len(record.ResourceTypes) != 2 || record.ResourceTypes[0] != "clb" || record.ResourceTypes[1] != "cdn" {
+		t.Errorf("got resource types %v, want [clb cdn]", record.ResourceTypes)
+	}
+
+	cert, ok := client.Certificate(record.CertID)
+	if !ok {
+		t.Fatalf("certificate %s was not uploaded", record.CertID)
+	}
+
+	publicKey, _ := base64.StdEncoding.DecodeString(target.PublicKey)
+	if cert.PublicKey != string(publicKey) {
+		t.Error("uploaded certificate does not hold the public key of the target")
+	}
+
+	if cert.Tags[TagSecret] != "app" {
+		t.Errorf("got tags %v, want the provenance tags of the target", cert.Tags)
+	}
+}
+
+func TestWatchCertificateUpdateStatus(t *testing.T) {
+	fastPolling(t)
+
+	update := func(t *testing.T, client *fake.SSLClient) *TencentSSLCertificate {
+		target := testTarget(t, "app", "app.example.com")
+		target.CertificateResourceTypes = []CertificateResourceType{{Name: "cdn"}}
+
+		oldPEM, oldKeyPEM := testCertificate(t, "app.example.com")
+		target.CertificateID = client.AddCertificate(fake.Certificate{
+			Alias:      "app",
+			PublicKey:  oldPEM,
+			PrivateKey: oldKeyPEM,
+			Status:     fake.CertificateStatusIssued,
+		})
+
+		err := target.UpdateCertificateDetail(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return target
+	}
+
+	t.Run("successful deployment retires the old certificate", func(t *testing.T) {
+		client := fake.NewSSLClient()
+		client.SetDeploySteps(fake.DeployStatusPending, fake.DeployStatusDeploying, fake.DeployStatusSuccess)
+
+		target := update(t, client)
+		oldCertID := target.CertificateID
+
+		certID, err := target.WatchCertificateUpdateStatus(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if certID == oldCertID {
+			t.Fatalf("got the old certificate %s, want the new one", certID)
+		}
+
+		cert, ok := client.Certificate(certID)
+		if !ok || cert.Alias != "app" {
+			t.Errorf("new certificate %s is not named app", certID)
+		}
+
+		if _, ok := client.Certificate(oldCertID); ok {
+			t.Errorf("old certificate %s was not deleted", oldCertID)
+		}
+	})
+
+	t.Run("failed deployment is rolled back", func(t *testing.T) {
+		client := fake.NewSSLClient()
+		client.SetDeploySteps(fake.DeployStatusDeploying, fake.DeployStatusFailed)
+
+		target := update(t, client)
+		oldCertID := target.CertificateID
+
+		// the rollback deployment succeeds
+		client.SetDeploySteps()
+
+		_, err := target.WatchCertificateUpdateStatus(client)
+
+		failed := &DeploymentFailedError{}
+		if !errors.As(err, &failed) {
+			t.Fatalf("got error %v, want a DeploymentFailedError", err)
+		}
+
+		if len(failed.Rollbacks) != 1 || !failed.Rollbacks[0].Succeeded {
+			t.Fatalf("got rollbacks %+v, want one successful rollback", failed.Rollbacks)
+		}
+
+		if failed.Rollbacks[0].RestoredCertificateID != oldCertID {
+			t.Errorf("rollback restored %s, want %s", failed.Rollbacks[0].RestoredCertificateID, oldCertID)
+		}
+
+		if _, ok := client.Certificate(oldCertID); !ok {
+			t.Errorf("old certificate %s was deleted after a failed deployment", oldCertID)
+		}
+	})
+
+	t.Run("deployment rolled back by tencent cloud is not rolled back again", func(t *testing.T) {
+		client := fake.NewSSLClient()
+		client.SetDeploySteps(fake.DeployStatusDeploying, fake.DeployStatusRollbackSucceeded)
+
+		target := update(t, client)
+
+		_, err := target.WatchCertificateUpdateStatus(client)
+
+		failed := &DeploymentFailedError{}
+		if !errors.As(err, &failed) {
+			t.Fatalf("got error %v, want a DeploymentFailedError", err)
+		}
+
+		if len(failed.Rollbacks) != 1 || !failed.Rollbacks[0].Succeeded {
+			t.Fatalf("got rollbacks %+v, want one successful rollback", failed.Rollbacks)
+		}
+
+		if records := client.DeployRecords(); len(records) != 1 {
+			t.Errorf("got %d deploy records, want no rollback deployment", len(records))
+		}
+	})
+
+	t.Run("deploy record not listed yet", func(t *testing.T) {
+		timeout := deployWatchTimeout
+		deployWatchTimeout = 20 * time.Millisecond
+		t.Cleanup(func() {
+			deployWatchTimeout = timeout
+		})
+
+		client := fake.NewSSLClient()
+
+		// no update ran, so no deploy record is ever listed
+		target := testTarget(t, "app", "app.example.com")
+		oldPEM, oldKeyPEM := testCertificate(t, "app.example.com")
+		target.CertificateID = client.AddCertificate(fake.Certificate{
+			Alias:      "app",
+			PublicKey:  oldPEM,
+			PrivateKey: oldKeyPEM,
+			Status:     fake.CertificateStatusIssued,
+		})
+
+		records, err := target.DescribeCertificateUpdateStatus(client)
+		if err != nil || len(records) != 0 {
+			t.Fatalf("got %d records with error %v, want none", len(records), err)
+		}
+
+		_, err = target.WatchCertificateUpdateStatus(client)
+		if err == nil || !strings.Contains(err.Error(), "did not finish within") {
+			t.Errorf("got error %v, want the deadline to be reached", err)
+		}
+	})
+
+	t.Run("deployment not finishing in time", func(t *testing.T) {
+		timeout := deployWatchTimeout
+		deployWatchTimeout = 20 * time.Millisecond
+		t.Cleanup(func() {
+			deployWatchTimeout = timeout
+		})
+
+		client := fake.NewSSLClient()
+		client.SetDeploySteps(fake.DeployStatusDeploying)
+
+		target := update(t, client)
+
+		_, err := target.WatchCertificateUpdateStatus(client)
+		if err == nil {
+			t.Fatal("got no error")
+		}
+
+		if target.Deployment.Total() != 1 || target.Deployment.Done() {
+			t.Errorf("got deployment %s, want the running record", target.Deployment)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package tencent
+
+import (
+	"sort"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+
+	sslCertificate "github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/ssl/v20191205"
+)
+
+// Tag keys tendo puts on the certificates it uploads.
+const (
+	TagManagedBy = "managed-by"
+	TagCluster   = "tendo-cluster"
+	TagNamespace = "tendo-namespace"
+	TagSecret    = "tendo-secret"
+
+	ManagedByTendo = "tendo"
+)
+
+type Tag struct {
+	TagKey   string `json:"TagKey"`
+	TagValue string `json:"TagValue"`
+}
+
+// ProvenanceTags returns the tags identifying the secret a certificate was
+// uploaded from.
+func ProvenanceTags(cluster string, namespace string, secretName string) map[string]string {
+	return map[string]string{
+		TagManagedBy: ManagedByTendo,
+		TagCluster:   cluster,
+		TagNamespace: namespace,
+		TagSecret:    secretName,
+	}
+}
+
+// TagMap returns the certificate tags as a map.
+func (c CertificateData) TagMap() map[string]string {
+	tags := map[string]string{}
+	for _, tag := range c.Tags {
+		tags[tag.TagKey] = tag.TagValue
+	}
+
+	return tags
+}
+
+func sslTags(tags map[string]string) []*sslCertificate.Tags {
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []*sslCertificate.Tags
+	for _, key := range keys {
+		result = append(result, &sslCertificate.Tags{
+			TagKey:   common.StringPtr(key),
+			TagValue: common.StringPtr(tags[key]),
+		})
+	}
+
+	return result
+}
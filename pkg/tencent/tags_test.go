@@ -0,0 +1,73 @@
+package tencent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+)
+
+func TestProvenanceTags(t *testing.T) {
+	client := fake.NewSSLClient()
+
+	app := testTarget(t, "app", "app.example.com")
+	app.Tags = ProvenanceTags("edge", "payments", "app")
+
+	certID, err := app.CreateCertificate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("uploaded certificate carries the provenance of its secret", func(t *testing.T) {
+		cert, ok := client.Certificate(certID)
+		if !ok {
+			t.Fatalf("certificate %s was not uploaded", certID)
+		}
+
+		want := map[string]string{
+			TagManagedBy: ManagedByTendo,
+			TagCluster:   "edge",
+			TagNamespace: "payments",
+			TagSecret:    "app",
+		}
+
+		if !reflect.DeepEqual(cert.Tags, want) {
+			t.Errorf("got tags %v, want %v", cert.Tags, want)
+		}
+	})
+
+	t.Run("certificates are listed by their tags", func(t *testing.T) {
+		other := testTarget(t, "app", "app.example.com")
+		other.Tags = ProvenanceTags("default", "payments", "app")
+
+		_, err := other.CreateCertificate(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificates, err := app.ListCertificates(client, "app", app.Tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(certificates) != 1 || certificates[0].CertificateID != certID {
+			t.Fatalf("got %d certificates, want only %s uploaded from the edge cluster", len(certificates), certID)
+		}
+
+		if got := certificates[0].TagMap(); !reflect.DeepEqual(got, app.Tags) {
+			t.Errorf("got tags %v, want %v", got, app.Tags)
+		}
+	})
+
+	t.Run("tags are sent in a stable order", func(t *testing.T) {
+		var keys []string
+		for _, tag := range sslTags(app.Tags) {
+			keys = append(keys, *tag.TagKey)
+		}
+
+		want := []string{TagManagedBy, TagCluster, TagNamespace, TagSecret}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("got keys %v, want %v", keys, want)
+		}
+	})
+}
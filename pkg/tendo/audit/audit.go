@@ -0,0 +1,134 @@
+// Package audit writes an event for every call tendo makes to change
+// something in Tencent Cloud, as JSON lines to a sink kept apart from the
+// operational log.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outputs writing to the standard streams instead of a file.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Log marks audit events, so they can be told apart from the operational
+// log when both are written to stdout.
+const Log = "audit"
+
+// Event is a mutating Tencent Cloud call. Actor is the tendo instance which
+// made it, Account the configured account it used and Target the watch
+// target it was made for.
+type Event struct {
+	Log              string    `json:"log"`
+	Time             time.Time `json:"time"`
+	Actor            string    `json:"actor"`
+	Account          string    `json:"account,omitempty"`
+	Target           string    `json:"target,omitempty"`
+	Action           string    `json:"action"`
+	CertificateID    string    `json:"certificateId,omitempty"`
+	OldCertificateID string    `json:"oldCertificateId,omitempty"`
+	Alias            string    `json:"alias,omitempty"`
+	Resources        []string  `json:"resources,omitempty"`
+	RequestID        string    `json:"requestId,omitempty"`
+	Result           string    `json:"result"`
+	Error            string    `json:"error,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	sink    io.Writer
+	closer  io.Closer
+	encoder *json.Encoder
+	actor   string
+)
+
+// Open sends events to output, which is stdout, stderr or the path of a
+// file events are appended to. An empty output disables the audit log.
+func Open(output string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if closer != nil {
+		closer.Close()
+		closer = nil
+	}
+	sink, encoder = nil, nil
+
+	switch output {
+	case "":
+		return nil
+	case OutputStdout:
+		sink = os.Stdout
+	case OutputStderr:
+		sink = os.Stderr
+	default:
+		file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			err := fmt.Errorf("unable to open audit log %s with error: %s", output, err)
+			return err
+		}
+
+		sink, closer = file, file
+	}
+
+	encoder = json.NewEncoder(sink)
+
+	actor, _ = os.Hostname()
+
+	return nil
+}
+
+// Record writes an event, filling in its time and actor. It does nothing
+// while the audit log is disabled.
+func Record(event Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if encoder == nil {
+		return
+	}
+
+	event.Log = Log
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	if event.Actor == "" {
+		event.Actor = actor
+	}
+
+	// an audit event that cannot be written must not go unnoticed
+	if err := encoder.Encode(event); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write audit event %s of certificate %s with error: %s\n", event.Action, event.CertificateID, err)
+	}
+}
+
+// Close closes the file of the audit log.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sink, encoder = nil, nil
+
+	if closer == nil {
+		return nil
+	}
+
+	err := closer.Close()
+	closer = nil
+
+	return err
+}
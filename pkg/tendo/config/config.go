@@ -5,33 +5,154 @@ import (
 	"os"
 	"time"
 
+	"github.com/fredytarigan/Tendo/pkg/tencent/resourcetype"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	AppName			string			`mapstructure:"APP_NAME"`
-	AppMode			string 			`mapstructure:"APP_MODE"`
-	AppHost			string 			`mapstructure:"APP_HOST"`
-	AppPort			string 			`mapstructure:"APP_PORT"`
+	AppName string `mapstructure:"APP_NAME"`
+	AppMode string `mapstructure:"APP_MODE"`
+	AppHost string `mapstructure:"APP_HOST"`
+	AppPort string `mapstructure:"APP_PORT"`
+
+	Tencent       TencentConfig   `mapstructure:"tencent"`
+	WatchInterval time.Duration   `mapstructure:"watchInterval"`
+	Clusters      []ClusterConfig `mapstructure:"clusters"`
+	Accounts      []AccountConfig `mapstructure:"accounts"`
+	WatchTargets  []WatchConfig   `mapstructure:"watchTargets"`
+	Inventory     InventoryConfig `mapstructure:"inventory"`
+	Audit         AuditConfig     `mapstructure:"audit"`
+	DryRun        bool            `mapstructure:"dryRun"`
+}
+
+type TencentConfig struct {
+	Endpoint       string          `mapstructure:"endpoint"`
+	CLBEndpoint    string          `mapstructure:"clbEndpoint"`
+	RootDomain     string          `mapstructure:"rootDomain"`
+	Proxy          string          `mapstructure:"proxy"`
+	CABundle       string          `mapstructure:"caBundle"`
+	RequestTimeout time.Duration   `mapstructure:"requestTimeout"`
+	RateLimit      RateLimitConfig `mapstructure:"rateLimit"`
+}
+
+// InventoryConfig enables the background inventory of every certificate of
+// the configured accounts, whether tendo manages it or not. Certificates
+// expiring within one of the thresholds are flagged.
+type InventoryConfig struct {
+	Enabled    bool            `mapstructure:"enabled"`
+	Interval   time.Duration   `mapstructure:"interval"`
+	Thresholds []time.Duration `mapstructure:"thresholds"`
+}
+
+// AuditConfig sends an event for every change made in tencent cloud to
+// Output, stdout, stderr or the path of a JSON lines file. The audit log is
+// disabled when Output is empty.
+type AuditConfig struct {
+	Output string `mapstructure:"output"`
+}
+
+type RateLimitConfig struct {
+	QPS     float64              `mapstructure:"qps"`
+	Burst   int                  `mapstructure:"burst"`
+	Actions map[string]RateLimit `mapstructure:"actions"`
+}
+
+type RateLimit struct {
+	QPS   float64 `mapstructure:"qps"`
+	Burst int     `mapstructure:"burst"`
+}
+
+type ClusterConfig struct {
+	Name       string `mapstructure:"name"`
+	Kubeconfig string `mapstructure:"kubeconfig"`
+	Context    string `mapstructure:"context"`
+	InCluster  bool   `mapstructure:"inCluster"`
+}
+
+// AccountConfig is a named Tencent Cloud account. Exactly one of SecretRef,
+// EnvPrefix and OIDC is set.
+type AccountConfig struct {
+	Name      string           `mapstructure:"name"`
+	SecretRef *SecretRefConfig `mapstructure:"secretRef"`
+	EnvPrefix string           `mapstructure:"envPrefix"`
+	OIDC      *OIDCConfig      `mapstructure:"oidc"`
+}
+
+type SecretRefConfig struct {
+	Cluster      string `mapstructure:"cluster"`
+	Namespace    string `mapstructure:"namespace"`
+	Name         string `mapstructure:"name"`
+	SecretIDKey  string `mapstructure:"secretIdKey"`
+	SecretKeyKey string `mapstructure:"secretKeyKey"`
+}
 
-	WatchInterval		time.Duration	`mapstructure:"watchInterval"`
-	WatchTargets  	 	[]WatchConfig	 `mapstructure:"watchTargets"`
-	
+type OIDCConfig struct {
+	Region          string `mapstructure:"region"`
+	ProviderID      string `mapstructure:"providerId"`
+	RoleArn         string `mapstructure:"roleArn"`
+	TokenFile       string `mapstructure:"tokenFile"`
+	SessionName     string `mapstructure:"sessionName"`
+	DurationSeconds int64  `mapstructure:"durationSeconds"`
 }
 
+// Sync directions of a watch target. Push targets upload the certificate of
+// a kubernetes secret to tencent cloud, pull targets write a tencent cloud
+// certificate into a kubernetes.io/tls secret.
+const (
+	ModePush = "push"
+	ModePull = "pull"
+)
+
 type WatchConfig struct {
-	SecretName		 		   string 	       			   `mapstructure:"secretName"`
-	OpaqueSecretName		   string	   				   `mapstructure:"opaqueSecretName"`
-	SecretNamespace			   string 	   				   `mapstructure:"secretNamespace"`
-	CertificateID 	 	 		string						`mapstructure:"certificateID"`
-	CertificateName		 		string 						`mapstructure:"certificateName"`
-	CertificateRegion	 		string						`mapstructure:"certificateRegion"`
-	CertificateResourceTypes	[]CertificateResourceType	 `mapstructure:"certificateResourceTypes"`
+	Mode                     string                    `mapstructure:"mode"`
+	Cluster                  string                    `mapstructure:"cluster"`
+	Account                  string                    `mapstructure:"account"`
+	SecretName               string                    `mapstructure:"secretName"`
+	OpaqueSecretName         string                    `mapstructure:"opaqueSecretName"`
+	SecretNamespace          string                    `mapstructure:"secretNamespace"`
+	CertificateID            string                    `mapstructure:"certificateID"`
+	CertificateName          string                    `mapstructure:"certificateName"`
+	CertificateMatchBy       string                    `mapstructure:"certificateMatchBy"`
+	CertificateDomain        string                    `mapstructure:"certificateDomain"`
+	CertificateRegion        string                    `mapstructure:"certificateRegion"`
+	CertificateResourceTypes []CertificateResourceType `mapstructure:"certificateResourceTypes"`
+	CertificateInstances     []CertificateInstance     `mapstructure:"certificateInstances"`
+	CLBListeners             []CLBListener             `mapstructure:"clbListeners"`
+	UploadCACertificate      bool                      `mapstructure:"uploadCaCertificate"`
+	SM2                      *SM2Config                `mapstructure:"sm2"`
+	Retention                RetentionConfig           `mapstructure:"retention"`
+	DryRun                   bool                      `mapstructure:"dryRun"`
+}
+
+// SM2Config names the secret keys holding the signing and encryption key
+// pairs of an SM2 certificate.
+type SM2Config struct {
+	SignCertificateKey    string `mapstructure:"signCertificateKey"`
+	SignPrivateKeyKey     string `mapstructure:"signPrivateKeyKey"`
+	EncryptCertificateKey string `mapstructure:"encryptCertificateKey"`
+	EncryptPrivateKeyKey  string `mapstructure:"encryptPrivateKeyKey"`
+}
+
+type RetentionConfig struct {
+	Keep        int           `mapstructure:"keep"`
+	GracePeriod time.Duration `mapstructure:"gracePeriod"`
 }
 
 type CertificateResourceType struct {
-	Name	string 		`mapstructure:"name"`
-	Regions	[]string 	`mapstructure:"regions"`
+	Name    resourcetype.ResourceType `mapstructure:"name"`
+	Regions []string                  `mapstructure:"regions"`
+}
+
+type CertificateInstance struct {
+	ResourceType resourcetype.ResourceType `mapstructure:"resourceType"`
+	InstanceIDs  []string                  `mapstructure:"instanceIds"`
+}
+
+type CLBListener struct {
+	Region         string `mapstructure:"region"`
+	LoadBalancerID string `mapstructure:"loadBalancerId"`
+	ListenerID     string `mapstructure:"listenerId"`
+	Domain         string `mapstructure:"domain"`
 }
 
 func SetConfigFile(path string) {
@@ -60,7 +181,7 @@ func LoadConfig() Config {
 	appHost := parseEnv("APP_HOST", "127.0.0.1")
 	appPort := parseEnv("APP_PORT", "8085")
 
-	conf  := &Config {
+	conf := &Config{
 		AppName: appName,
 		AppMode: appMode,
 		AppHost: appHost,
@@ -71,19 +192,25 @@ func LoadConfig() Config {
 		log.Fatal("error reading config file", errConfig)
 	}
 
-	errConfig = viper.Unmarshal(&conf)
+	errConfig = viper.Unmarshal(&conf, decodeHook())
 	if errConfig != nil {
 		log.Fatal("error unmarshal config file", errConfig)
 	}
 
+	conf.setDefaults()
+
+	errConfig = conf.Validate()
+	if errConfig != nil {
+		log.Fatal("invalid config file", errConfig)
+	}
+
 	return *conf
 }
 
-
 func parseEnv(env string, defEnv string) string {
 	if os.Getenv(env) == "" {
 		return defEnv
 	} else {
 		return os.Getenv(env)
 	}
-}
\ No newline at end of file
+}
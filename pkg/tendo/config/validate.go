@@ -0,0 +1,340 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent/resourcetype"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// resourceTypeHook accepts the "- clb" shorthand for certificateResourceTypes
+// entries, as used by deploy/configmap.yaml, next to "- name: clb".
+func resourceTypeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(CertificateResourceType{}) {
+		return data, nil
+	}
+
+	return map[string]interface{}{
+		"name": data,
+	}, nil
+}
+
+func decodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		resourceTypeHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+}
+
+// setDefaults fills in the inventory interval and thresholds and the secret
+// keys of SM2 targets, and deploys regional resource types listed without
+// regions to the region of the certificate.
+func (c *Config) setDefaults() {
+	if c.Inventory.Interval == 0 {
+		c.Inventory.Interval = defaultInventoryInterval
+	}
+
+	if len(c.Inventory.Thresholds) == 0 {
+		c.Inventory.Thresholds = defaultInventoryThresholds
+	}
+
+	for i := range c.WatchTargets {
+		item := &c.WatchTargets[i]
+
+		if item.SM2 != nil {
+			item.SM2.setDefaults()
+		}
+
+		for j := range item.CertificateResourceTypes {
+			value := &item.CertificateResourceTypes[j]
+			if value.Name.RequiresRegion() && len(value.Regions) == 0 && item.CertificateRegion != "" {
+				value.Regions = []string{item.CertificateRegion}
+			}
+		}
+	}
+}
+
+func (s *SM2Config) setDefaults() {
+	if s.SignCertificateKey == "" {
+		s.SignCertificateKey = "tls.crt"
+	}
+
+	if s.SignPrivateKeyKey == "" {
+		s.SignPrivateKeyKey = "tls.key"
+	}
+
+	if s.EncryptCertificateKey == "" {
+		s.EncryptCertificateKey = "enc.crt"
+	}
+
+	if s.EncryptPrivateKeyKey == "" {
+		s.EncryptPrivateKeyKey = "enc.key"
+	}
+}
+
+// The inventory runs hourly and flags certificates expiring within 30 and 7
+// days unless configured otherwise.
+var (
+	defaultInventoryInterval   = time.Hour
+	defaultInventoryThresholds = []time.Duration{30 * 24 * time.Hour, 7 * 24 * time.Hour}
+)
+
+// Validate checks the watch targets, so unsupported resource types and
+// region combinations fail before any Tencent Cloud API call.
+func (c *Config) Validate() error {
+	var errs []error
+
+	for _, err := range c.Tencent.validate() {
+		errs = append(errs, fmt.Errorf("tencent: %w", err))
+	}
+
+	for _, err := range c.Inventory.validate() {
+		errs = append(errs, fmt.Errorf("inventory: %w", err))
+	}
+
+	// the default cluster falls back to --kubeconfig when it is not listed
+	clusters := map[string]bool{defaultClusterName: true}
+	for _, cluster := range c.Clusters {
+		clusters[cluster.Name] = true
+	}
+
+	accounts := map[string]bool{}
+	for _, account := range c.Accounts {
+		if accounts[account.Name] {
+			errs = append(errs, fmt.Errorf("account %s is defined more than once", account.Name))
+		}
+		accounts[account.Name] = true
+
+		if account.SecretRef != nil && account.SecretRef.Cluster != "" && !clusters[account.SecretRef.Cluster] {
+			errs = append(errs, fmt.Errorf("account %s: cluster %s is not defined", account.Name, account.SecretRef.Cluster))
+		}
+
+		for _, err := range account.validate() {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Name, err))
+		}
+	}
+
+	for _, item := range c.WatchTargets {
+		target := fmt.Sprintf("%s/%s", item.SecretNamespace, item.SecretName)
+
+		if item.Cluster != "" && !clusters[item.Cluster] {
+			errs = append(errs, fmt.Errorf("watch target %s: cluster %s is not defined", target, item.Cluster))
+		}
+
+		if item.Account != "" && !accounts[item.Account] {
+			errs = append(errs, fmt.Errorf("watch target %s: account %s is not defined", target, item.Account))
+		}
+
+		for _, err := range item.validate() {
+			errs = append(errs, fmt.Errorf("watch target %s: %w", target, err))
+		}
+	}
+
+	// a pull target writing the secret a push target uploads from would
+	// feed the certificate back into itself
+	pushed := map[string]bool{}
+	for _, item := range c.WatchTargets {
+		if item.Mode != ModePull {
+			pushed[item.secretKey()] = true
+		}
+	}
+
+	for _, item := range c.WatchTargets {
+		if item.Mode == ModePull && pushed[item.secretKey()] {
+			errs = append(errs, fmt.Errorf("watch target %s/%s: pull mode writes the secret of a push target", item.SecretNamespace, item.SecretName))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// defaultClusterName is the cluster of watch targets without one, the
+// cluster given by --kubeconfig.
+const defaultClusterName = "default"
+
+// secretKey identifies the secret of a watch target across clusters.
+func (item WatchConfig) secretKey() string {
+	cluster := item.Cluster
+	if cluster == "" {
+		cluster = defaultClusterName
+	}
+
+	return fmt.Sprintf("%s/%s/%s", cluster, item.SecretNamespace, item.SecretName)
+}
+
+func (i InventoryConfig) validate() []error {
+	var errs []error
+
+	if i.Interval < 0 {
+		errs = append(errs, fmt.Errorf("interval %s must not be negative", i.Interval))
+	}
+
+	for _, threshold := range i.Thresholds {
+		if threshold <= 0 {
+			errs = append(errs, fmt.Errorf("threshold %s must be positive", threshold))
+		}
+	}
+
+	return errs
+}
+
+func (t TencentConfig) validate() []error {
+	var errs []error
+
+	for _, endpoint := range []string{t.Endpoint, t.CLBEndpoint} {
+		if scheme, _, found := strings.Cut(endpoint, "://"); found && scheme != "http" && scheme != "https" {
+			errs = append(errs, fmt.Errorf("endpoint %s must use http or https", endpoint))
+		}
+	}
+
+	if t.Proxy != "" {
+		proxy, err := url.Parse(t.Proxy)
+		if err != nil || proxy.Host == "" {
+			errs = append(errs, fmt.Errorf("proxy %s is not a valid url", t.Proxy))
+		} else if proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" {
+			errs = append(errs, fmt.Errorf("proxy %s must use http, https or socks5", t.Proxy))
+		}
+	}
+
+	if t.CABundle != "" {
+		if _, err := os.Stat(t.CABundle); err != nil {
+			errs = append(errs, fmt.Errorf("caBundle %s is not readable: %w", t.CABundle, err))
+		}
+	}
+
+	if t.RequestTimeout < 0 {
+		errs = append(errs, fmt.Errorf("requestTimeout must not be negative"))
+	}
+
+	return errs
+}
+
+func (item WatchConfig) validate() []error {
+	var errs []error
+
+	switch item.Mode {
+	case "", ModePush:
+	case ModePull:
+		if item.CertificateName == "" {
+			errs = append(errs, errors.New("pull mode requires certificateName"))
+		}
+
+		// renewed certificates are issued under a new id, so a pinned id
+		// would be pulled forever after it expired
+		if item.CertificateID != "" {
+			errs = append(errs, errors.New("pull mode follows renewals by certificateName, remove certificateID"))
+		}
+
+		if len(item.CertificateResourceTypes) > 0 || len(item.CertificateInstances) > 0 || len(item.CLBListeners) > 0 || item.UploadCACertificate || item.SM2 != nil {
+			errs = append(errs, errors.New("pull mode does not deploy certificates, remove certificateResourceTypes, certificateInstances, clbListeners, uploadCaCertificate and sm2"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported mode %s, expected %s or %s", item.Mode, ModePush, ModePull))
+	}
+
+	if item.SecretName == "" || item.SecretNamespace == "" {
+		errs = append(errs, errors.New("secretName and secretNamespace are required"))
+	}
+
+	seen := map[resourcetype.ResourceType]bool{}
+	for _, value := range item.CertificateResourceTypes {
+		if _, err := resourcetype.Parse(string(value.Name)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if seen[value.Name] {
+			errs = append(errs, fmt.Errorf("resource type %s is listed more than once", value.Name))
+		}
+		seen[value.Name] = true
+
+		if value.Name.RequiresRegion() && len(value.Regions) == 0 {
+			errs = append(errs, fmt.Errorf("resource type %s requires regions, set regions or certificateRegion", value.Name))
+		}
+
+		if !value.Name.RequiresRegion() && len(value.Regions) > 0 {
+			errs = append(errs, fmt.Errorf("resource type %s is global and does not take regions", value.Name))
+		}
+	}
+
+	// the opaque secret records which instances run the certificate
+	if len(item.CertificateInstances) > 0 && item.OpaqueSecretName == "" {
+		errs = append(errs, errors.New("certificateInstances require opaqueSecretName"))
+	}
+
+	for _, value := range item.CertificateInstances {
+		if _, err := resourcetype.Parse(string(value.ResourceType)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(value.InstanceIDs) == 0 {
+			errs = append(errs, fmt.Errorf("certificate instances of resource type %s require instanceIds", value.ResourceType))
+		}
+	}
+
+	for _, value := range item.CLBListeners {
+		if value.LoadBalancerID == "" || value.ListenerID == "" {
+			errs = append(errs, errors.New("clb listeners require loadBalancerId and listenerId"))
+		}
+	}
+
+	if item.Retention.Keep < 0 {
+		errs = append(errs, fmt.Errorf("retention keep %d must not be negative", item.Retention.Keep))
+	}
+
+	if item.Retention.GracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("retention gracePeriod %s must not be negative", item.Retention.GracePeriod))
+	}
+
+	if item.SM2 != nil {
+		keys := map[string]bool{}
+		for _, key := range []string{item.SM2.SignCertificateKey, item.SM2.SignPrivateKeyKey, item.SM2.EncryptCertificateKey, item.SM2.EncryptPrivateKeyKey} {
+			if keys[key] {
+				errs = append(errs, fmt.Errorf("sm2 secret key %s is used more than once", key))
+			}
+			keys[key] = true
+		}
+	}
+
+	return errs
+}
+
+func (account AccountConfig) validate() []error {
+	var errs []error
+
+	if account.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	sources := 0
+	if account.SecretRef != nil {
+		sources++
+
+		if account.SecretRef.Namespace == "" || account.SecretRef.Name == "" {
+			errs = append(errs, errors.New("secretRef requires namespace and name"))
+		}
+	}
+
+	if account.EnvPrefix != "" {
+		sources++
+	}
+
+	if account.OIDC != nil {
+		sources++
+	}
+
+	if sources != 1 {
+		errs = append(errs, errors.New("exactly one of secretRef, envPrefix and oidc must be set"))
+	}
+
+	return errs
+}
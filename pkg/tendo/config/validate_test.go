@@ -0,0 +1,211 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	// valid returns a config with a push and a pull target, each test breaks
+	// one part of it
+	valid := func() Config {
+		return Config{
+			Clusters: []ClusterConfig{{Name: "edge", Kubeconfig: "/etc/tendo/edge.kubeconfig"}},
+			Accounts: []AccountConfig{{
+				Name:      "main",
+				SecretRef: &SecretRefConfig{Namespace: "tendo", Name: "tencent-credentials"},
+			}},
+			WatchTargets: []WatchConfig{
+				{
+					Account:          "main",
+					SecretName:       "app-tls",
+					SecretNamespace:  "app",
+					OpaqueSecretName: "app-qcloud",
+					CertificateName:  "app",
+					Retention:        RetentionConfig{Keep: 2, GracePeriod: time.Hour},
+				},
+				{
+					Mode:            ModePull,
+					Cluster:         "edge",
+					Account:         "main",
+					SecretName:      "shop-tls",
+					SecretNamespace: "shop",
+					CertificateName: "shop",
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		errs   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "default cluster without clusters",
+			modify: func(c *Config) {
+				c.Clusters = nil
+				c.WatchTargets[1].Cluster = "default"
+			},
+		},
+		{
+			name: "undefined cluster",
+			modify: func(c *Config) {
+				c.WatchTargets[0].Cluster = "staging"
+			},
+			errs: []string{"watch target app/app-tls: cluster staging is not defined"},
+		},
+		{
+			name: "undefined secretRef cluster",
+			modify: func(c *Config) {
+				c.Accounts[0].SecretRef.Cluster = "staging"
+			},
+			errs: []string{"account main: cluster staging is not defined"},
+		},
+		{
+			name: "undefined account",
+			modify: func(c *Config) {
+				c.WatchTargets[0].Account = "other"
+			},
+			errs: []string{"watch target app/app-tls: account other is not defined"},
+		},
+		{
+			name: "negative retention",
+			modify: func(c *Config) {
+				c.WatchTargets[0].Retention = RetentionConfig{Keep: -1, GracePeriod: -time.Hour}
+			},
+			errs: []string{
+				"retention keep -1 must not be negative",
+				"retention gracePeriod -1h0m0s must not be negative",
+			},
+		},
+		{
+			name: "pull target pinned to a certificate id",
+			modify: func(c *Config) {
+				c.WatchTargets[1].CertificateID = "abcd1234"
+			},
+			errs: []string{"watch target shop/shop-tls: pull mode follows renewals by certificateName, remove certificateID"},
+		},
+		{
+			name: "pull target without certificate name",
+			modify: func(c *Config) {
+				c.WatchTargets[1].CertificateName = ""
+			},
+			errs: []string{"pull mode requires certificateName"},
+		},
+		{
+			name: "pull target writing a pushed secret",
+			modify: func(c *Config) {
+				c.WatchTargets[1].Cluster = ""
+				c.WatchTargets[1].SecretName = "app-tls"
+				c.WatchTargets[1].SecretNamespace = "app"
+			},
+			errs: []string{"pull mode writes the secret of a push target"},
+		},
+		{
+			name: "regional resource type without regions",
+			modify: func(c *Config) {
+				c.WatchTargets[0].CertificateResourceTypes = []CertificateResourceType{{Name: "clb"}}
+			},
+			errs: []string{"resource type clb requires regions"},
+		},
+		{
+			name: "certificate instances without opaque secret",
+			modify: func(c *Config) {
+				c.WatchTargets[0].OpaqueSecretName = ""
+				c.WatchTargets[0].CertificateInstances = []CertificateInstance{{ResourceType: "cdn", InstanceIDs: []string{"app.example.com"}}}
+			},
+			errs: []string{"certificateInstances require opaqueSecretName"},
+		},
+		{
+			name: "account with two credential sources",
+			modify: func(c *Config) {
+				c.Accounts[0].EnvPrefix = "MAIN"
+			},
+			errs: []string{"account main: exactly one of secretRef, envPrefix and oidc must be set"},
+		},
+		{
+			name: "duplicate account",
+			modify: func(c *Config) {
+				c.Accounts = append(c.Accounts, c.Accounts[0])
+			},
+			errs: []string{"account main is defined more than once"},
+		},
+		{
+			name: "negative inventory threshold",
+			modify: func(c *Config) {
+				c.Inventory.Thresholds = []time.Duration{-time.Hour}
+			},
+			errs: []string{"inventory: threshold -1h0m0s must be positive"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := valid()
+			test.modify(&c)
+
+			err := c.Validate()
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("got no error, want %q", test.errs)
+			}
+
+			for _, want := range test.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got error %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	c := Config{
+		WatchTargets: []WatchConfig{{
+			CertificateRegion: "ap-singapore",
+			CertificateResourceTypes: []CertificateResourceType{
+				{Name: "clb"},
+				{Name: "waf", Regions: []string{"ap-hongkong"}},
+				{Name: "cdn"},
+			},
+			SM2: &SM2Config{EncryptCertificateKey: "sm2-enc.crt"},
+		}},
+	}
+
+	c.setDefaults()
+
+	if c.Inventory.Interval != time.Hour || !reflect.DeepEqual(c.Inventory.Thresholds, defaultInventoryThresholds) {
+		t.Errorf("got inventory every %s flagging %v, want the defaults", c.Inventory.Interval, c.Inventory.Thresholds)
+	}
+
+	item := c.WatchTargets[0]
+	regions := [][]string{{"ap-singapore"}, {"ap-hongkong"}, nil}
+	for i, value := range item.CertificateResourceTypes {
+		if !reflect.DeepEqual(value.Regions, regions[i]) {
+			t.Errorf("resource type %s got regions %v, want %v", value.Name, value.Regions, regions[i])
+		}
+	}
+
+	want := SM2Config{
+		SignCertificateKey:    "tls.crt",
+		SignPrivateKeyKey:     "tls.key",
+		EncryptCertificateKey: "sm2-enc.crt",
+		EncryptPrivateKeyKey:  "enc.key",
+	}
+	if *item.SM2 != want {
+		t.Errorf("got sm2 keys %+v, want %+v", *item.SM2, want)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// Logger is configured by Init, tests set it up themselves since they run
+// without a config file.
 var Logger *zap.Logger
 
 func getLoggerLevel(level string) zapcore.Level {
@@ -18,7 +20,8 @@ func getLoggerLevel(level string) zapcore.Level {
 	return zap.InfoLevel
 }
 
-func init() {
+// Init builds Logger in the mode configured in config.yaml.
+func Init() {
 	var err error
 	var logLevel string
 	var is_development bool
@@ -43,7 +46,7 @@ func init() {
 	zapConfig.Encoding = "json"
 	zapConfig.ErrorOutputPaths = []string{"stderr"}
 	zapConfig.OutputPaths = []string{"stdout"}
-	
+
 	logger, err := zapConfig.Build()
 
 	if err != nil {
@@ -0,0 +1,170 @@
+// Package metrics keeps process-wide counters and gauges and serves them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	counterType metricType = "counter"
+	gaugeType   metricType = "gauge"
+)
+
+type metric struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	kind   metricType
+	labels []string
+	values map[string]float64
+}
+
+type CounterVec struct {
+	metric *metric
+}
+
+type GaugeVec struct {
+	metric *metric
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*metric{}
+)
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		metric: register(name, help, counterType, labels),
+	}
+}
+
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{
+		metric: register(name, help, gaugeType, labels),
+	}
+}
+
+// Add increases the counter for the given label values.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.metric.update(labelValues, func(current float64) float64 {
+		return current + value
+	})
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Set sets the gauge for the given label values.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.metric.update(labelValues, func(float64) float64 {
+		return value
+	})
+}
+
+// Reset drops all label values of the gauge, e.g. before publishing a fresh
+// snapshot.
+func (g *GaugeVec) Reset() {
+	g.metric.mu.Lock()
+	defer g.metric.mu.Unlock()
+
+	g.metric.values = map[string]float64{}
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		registryMu.Lock()
+		var names []string
+		for name := range registry {
+			names = append(names, name)
+		}
+		registryMu.Unlock()
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			registryMu.Lock()
+			m := registry[name]
+			registryMu.Unlock()
+
+			m.write(w)
+		}
+	})
+}
+
+func register(name string, help string, kind metricType, labels []string) *metric {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if m, ok := registry[name]; ok {
+		return m
+	}
+
+	m := &metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: map[string]float64{},
+	}
+	registry[name] = m
+
+	return m
+}
+
+func (m *metric) update(labelValues []string, fn func(float64) float64) {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+
+	key := m.key(labelValues)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[key] = fn(m.values[key])
+}
+
+// key renders label values as the {name="value",...} part of a sample.
+func (m *metric) key(labelValues []string) string {
+	if len(m.labels) == 0 {
+		return ""
+	}
+
+	var pairs []string
+	for i, label := range m.labels {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labelValues[i])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, value))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+
+	var keys []string
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %g\n", m.name, key, m.values[key])
+	}
+}
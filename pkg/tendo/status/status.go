@@ -0,0 +1,155 @@
+// Package status keeps the latest outcome of every watch target and the
+// certificate inventory of every account, and serves them as JSON on the
+// status API.
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ResultUpToDate       = "up-to-date"
+	ResultUpdated        = "updated"
+	ResultFailed         = "failed"
+	ResultRolledBack     = "rolled-back"
+	ResultRollbackFailed = "rollback-failed"
+	ResultDryRun         = "dry-run"
+)
+
+type TargetStatus struct {
+	Target        string       `json:"target"`
+	Cluster       string       `json:"cluster"`
+	CertificateID string       `json:"certificateId,omitempty"`
+	Result        string       `json:"result"`
+	Message       string       `json:"message,omitempty"`
+	Planned       []string     `json:"planned,omitempty"`
+	Rollbacks     []Rollback   `json:"rollbacks,omitempty"`
+	Deployments   []Deployment `json:"deployments,omitempty"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+}
+
+// Rollback describes a failed deployment that was moved back to the
+// previous certificate.
+type Rollback struct {
+	FailedCertificateID   string   `json:"failedCertificateId"`
+	RestoredCertificateID string   `json:"restoredCertificateId"`
+	ResourceTypes         []string `json:"resourceTypes"`
+	Regions               []string `json:"regions,omitempty"`
+	Succeeded             bool     `json:"succeeded"`
+	Error                 string   `json:"error,omitempty"`
+}
+
+// Deployment is the outcome of deploying the certificate to one resource type
+// in one region.
+type Deployment struct {
+	ResourceType    string `json:"resourceType"`
+	Region          string `json:"region,omitempty"`
+	Status          string `json:"status"`
+	DeployRecordIDs []int  `json:"deployRecordIds,omitempty"`
+}
+
+// AccountInventory is the latest certificate inventory of one account.
+type AccountInventory struct {
+	Account      string                `json:"account"`
+	Certificates int                   `json:"certificates"`
+	Expiring     []ExpiringCertificate `json:"expiring,omitempty"`
+	Message      string                `json:"message,omitempty"`
+	UpdatedAt    time.Time             `json:"updatedAt"`
+}
+
+// ExpiringCertificate is a certificate which expires within Threshold, or
+// has expired already when Threshold is "expired".
+type ExpiringCertificate struct {
+	CertificateID  string    `json:"certificateId"`
+	Alias          string    `json:"alias,omitempty"`
+	Domain         string    `json:"domain,omitempty"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	Threshold      string    `json:"threshold"`
+	BoundResources []string  `json:"boundResources,omitempty"`
+	Managed        bool      `json:"managed"`
+}
+
+type Report struct {
+	Targets   []TargetStatus     `json:"targets"`
+	Inventory []AccountInventory `json:"inventory,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	targets   = map[string]TargetStatus{}
+	inventory = map[string]AccountInventory{}
+)
+
+// SetTarget records the latest status of a watch target.
+func SetTarget(target TargetStatus) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if target.UpdatedAt.IsZero() {
+		target.UpdatedAt = time.Now()
+	}
+
+	targets[target.Target] = target
+}
+
+// SetInventory records the latest inventory of an account.
+func SetInventory(account AccountInventory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if account.UpdatedAt.IsZero() {
+		account.UpdatedAt = time.Now()
+	}
+
+	inventory[account.Account] = account
+}
+
+// Inventory returns the latest inventory of an account.
+func Inventory(account string) (AccountInventory, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, ok := inventory[account]
+
+	return result, ok
+}
+
+// Snapshot returns the current report with targets and inventories sorted
+// by name.
+func Snapshot() Report {
+	mu.Lock()
+	defer mu.Unlock()
+
+	report := Report{
+		Targets: []TargetStatus{},
+	}
+
+	for _, target := range targets {
+		report.Targets = append(report.Targets, target)
+	}
+
+	sort.Slice(report.Targets, func(i, j int) bool {
+		return report.Targets[i].Target < report.Targets[j].Target
+	})
+
+	for _, account := range inventory {
+		report.Inventory = append(report.Inventory, account)
+	}
+
+	sort.Slice(report.Inventory, func(i, j int) bool {
+		return report.Inventory[i].Account < report.Inventory[j].Account
+	})
+
+	return report
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Snapshot())
+	})
+}
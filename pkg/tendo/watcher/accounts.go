@@ -0,0 +1,120 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/tencentcloud/tencentcloud-sdk-go-intl-en/tencentcloud/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Keys read from an account secretRef when the account does not name them.
+const (
+	DefaultSecretIDKey  = "secretId"
+	DefaultSecretKeyKey = "secretKey"
+	secretTokenKey      = "token"
+)
+
+// credentials caches the credentials of every account for all watch targets.
+var credentials = tencent.NewCredentialManager()
+
+// ResolveCredentials returns the credentials of the account a watch target
+// manages its certificate in. Targets without an account use the global
+// credentials from env, TKE OIDC or profile. Credentials are cached and
+// refreshed before they expire.
+func ResolveCredentials(c *config.Config, kubeconfig string, name string) (common.CredentialIface, error) {
+	if name == "" {
+		return credentials.Get("", tencent.DefaultCredentialSource)
+	}
+
+	for _, account := range c.Accounts {
+		if account.Name != name {
+			continue
+		}
+
+		return credentials.Get(account.Name, accountCredentialSource(c, kubeconfig, account))
+	}
+
+	err := fmt.Errorf("account %s is not defined in config", name)
+	return nil, err
+}
+
+// InvalidateCredentials drops the cached credentials of an account after
+// Tencent Cloud rejected them.
+func InvalidateCredentials(name string) {
+	credentials.Invalidate(name)
+}
+
+// accountCredentialSource reads the account secretRef on every refresh, so
+// rotated keys are picked up without a restart.
+func accountCredentialSource(c *config.Config, kubeconfig string, account config.AccountConfig) tencent.CredentialSource {
+	return func() (common.CredentialIface, time.Duration, error) {
+		tencentAccount := tencent.Account{
+			Name:      account.Name,
+			EnvPrefix: account.EnvPrefix,
+		}
+
+		if account.SecretRef != nil {
+			err := readAccountSecret(c, kubeconfig, *account.SecretRef, &tencentAccount)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if account.OIDC != nil {
+			tencentAccount.OIDC = &tencent.OIDCRole{
+				Region:          account.OIDC.Region,
+				ProviderID:      account.OIDC.ProviderID,
+				RoleArn:         account.OIDC.RoleArn,
+				TokenFile:       account.OIDC.TokenFile,
+				SessionName:     account.OIDC.SessionName,
+				DurationSeconds: account.OIDC.DurationSeconds,
+			}
+		}
+
+		return tencent.AccountCredentialSource(tencentAccount)()
+	}
+}
+
+func readAccountSecret(c *config.Config, kubeconfig string, ref config.SecretRefConfig, account *tencent.Account) error {
+	cluster, err := ResolveCluster(c, kubeconfig, ref.Cluster)
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	secret, err := client.CoreV1().Secrets(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		err := fmt.Errorf("unable to get credentials secret %s of account %s with error: %s", ref.Name, account.Name, err)
+		return err
+	}
+
+	secretIDKey := ref.SecretIDKey
+	if secretIDKey == "" {
+		secretIDKey = DefaultSecretIDKey
+	}
+
+	secretKeyKey := ref.SecretKeyKey
+	if secretKeyKey == "" {
+		secretKeyKey = DefaultSecretKeyKey
+	}
+
+	account.SecretID = string(secret.Data[secretIDKey])
+	account.SecretKey = string(secret.Data[secretKeyKey])
+	account.Token = string(secret.Data[secretTokenKey])
+
+	if account.SecretID == "" {
+		err := fmt.Errorf("key %s not found in credentials secret %s of account %s", secretIDKey, ref.Name, account.Name)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	env := newTestEnvironment(t, &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "billing-credentials", Namespace: "billing"},
+		Data: map[string][]byte{
+			"id":  []byte("AKIDbilling"),
+			"key": []byte("billing-secret"),
+		},
+	})
+	env.config.Accounts = append(env.config.Accounts, config.AccountConfig{
+		Name: "billing",
+		SecretRef: &config.SecretRefConfig{
+			Namespace:    "billing",
+			Name:         "billing-credentials",
+			SecretIDKey:  "id",
+			SecretKeyKey: "key",
+		},
+	})
+
+	// rotate replaces the key pair in the secret of the test account
+	rotate := func(t *testing.T, secretID string) {
+		t.Helper()
+
+		secrets := env.kube.CoreV1().Secrets("tendo")
+
+		secret, err := secrets.Get(context.TODO(), "tencent-credentials", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret.Data[DefaultSecretIDKey] = []byte(secretID)
+
+		_, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secretID := func(t *testing.T, account string) string {
+		t.Helper()
+
+		creds, err := ResolveCredentials(env.config, "", account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return creds.GetSecretId()
+	}
+
+	t.Run("each account reads its own secret", func(t *testing.T) {
+		if got := secretID(t, "test"); got != "AKIDtendotest" {
+			t.Errorf("test account got %s, want AKIDtendotest", got)
+		}
+
+		creds, err := ResolveCredentials(env.config, "", "billing")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.GetSecretId() != "AKIDbilling" || creds.GetSecretKey() != "billing-secret" {
+			t.Errorf("billing account got %s, want the keys named by its secretRef", creds.GetSecretId())
+		}
+	})
+
+	t.Run("undefined account", func(t *testing.T) {
+		_, err := ResolveCredentials(env.config, "", "marketing")
+		if err == nil {
+			t.Fatal("got no error for an undefined account")
+		}
+	})
+
+	t.Run("rotated secret is read once the cache is invalidated", func(t *testing.T) {
+		secretID(t, "test")
+		rotate(t, "AKIDrotated")
+
+		if got := secretID(t, "test"); got != "AKIDtendotest" {
+			t.Fatalf("got %s before the cached credentials were invalidated", got)
+		}
+
+		InvalidateCredentials("test")
+
+		if got := secretID(t, "test"); got != "AKIDrotated" {
+			t.Errorf("got %s, want the rotated key AKIDrotated", got)
+		}
+
+		if got := secretID(t, "billing"); got != "AKIDbilling" {
+			t.Errorf("billing account got %s, want it untouched", got)
+		}
+	})
+
+	t.Run("credentials rejected by the inventory are rebuilt", func(t *testing.T) {
+		secretID(t, "test")
+		rotate(t, "AKIDrenewed")
+
+		env.ssl.InjectError("DescribeCertificates", "AuthFailure.SecretIdNotFound", "secret id does not exist", 1)
+
+		RunInventory(context.Background(), env.config, "")
+
+		if got := secretID(t, "test"); got != "AKIDrenewed" {
+			t.Errorf("got %s, want the rotated key AKIDrenewed read after the auth failure", got)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package watcher
+
+import (
+	"fmt"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+)
+
+const DefaultClusterName = "default"
+
+// ResolveCluster looks up the cluster a watch target reads its secret from.
+// Targets without a cluster use the "default" cluster, which falls back to
+// the --kubeconfig flag when it is not listed in config.
+func ResolveCluster(c *config.Config, kubeconfig string, name string) (k8s.ClusterConfig, error) {
+	if name == "" {
+		name = DefaultClusterName
+	}
+
+	for _, cluster := range c.Clusters {
+		if cluster.Name == name {
+			return k8s.ClusterConfig{
+				Name:       cluster.Name,
+				Kubeconfig: cluster.Kubeconfig,
+				Context:    cluster.Context,
+				InCluster:  cluster.InCluster,
+			}, nil
+		}
+	}
+
+	if name == DefaultClusterName {
+		return k8s.ClusterConfig{
+			Name:       DefaultClusterName,
+			Kubeconfig: kubeconfig,
+		}, nil
+	}
+
+	err := fmt.Errorf("cluster %s is not defined in config", name)
+	return k8s.ClusterConfig{}, err
+}
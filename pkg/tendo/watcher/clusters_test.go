@@ -0,0 +1,124 @@
+package watcher
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveCluster(t *testing.T) {
+	c := &config.Config{
+		Clusters: []config.ClusterConfig{
+			{Name: "edge", Kubeconfig: "/etc/tendo/edge.kubeconfig", Context: "edge-admin"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cluster string
+		want    k8s.ClusterConfig
+		err     bool
+	}{
+		{
+			name:    "configured cluster",
+			cluster: "edge",
+			want:    k8s.ClusterConfig{Name: "edge", Kubeconfig: "/etc/tendo/edge.kubeconfig", Context: "edge-admin"},
+		},
+		{
+			name: "default cluster from --kubeconfig",
+			want: k8s.ClusterConfig{Name: DefaultClusterName, Kubeconfig: "/root/.kube/config"},
+		},
+		{
+			name:    "undefined cluster",
+			cluster: "staging",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveCluster(c, "/root/.kube/config", test.cluster)
+			if test.err {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunLoopOtherCluster(t *testing.T) {
+	env := newTestEnvironment(t)
+	env.config.Clusters = []config.ClusterConfig{{Name: "edge", Context: "edge"}}
+
+	certPEM, keyPEM := testCertificate(t, "edge.example.com")
+	edge := k8sfake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "tendo"},
+		Type:       apiv1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": []byte(certPEM),
+			"tls.key": []byte(keyPEM),
+		},
+	})
+
+	// the credentials stay in the default cluster
+	k8s.ClusterClientFactory = func(cluster k8s.ClusterConfig) (kubernetes.Interface, error) {
+		if cluster.Name == "edge" {
+			return edge, nil
+		}
+
+		return env.kube, nil
+	}
+
+	item := env.target("app")
+	item.Cluster = "edge"
+
+	err := RunLoop(context.Background(), env.config, "", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificates := env.ssl.Certificates()
+	if len(certificates) != 1 {
+		t.Fatalf("got %d certificates, want the one of the edge secret", len(certificates))
+	}
+
+	if want := tencent.ProvenanceTags("edge", "tendo", "app"); !reflect.DeepEqual(certificates[0].Tags, want) {
+		t.Errorf("got tags %v, want %v", certificates[0].Tags, want)
+	}
+
+	opaque, err := edge.CoreV1().Secrets("tendo").Get(context.TODO(), "app-opaque", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("opaque secret was not written to the edge cluster: %s", err)
+	}
+
+	if opaque.StringData[OpaqueCertID] != certificates[0].CertificateID {
+		t.Errorf("opaque secret holds %s, want %s", opaque.StringData[OpaqueCertID], certificates[0].CertificateID)
+	}
+
+	if _, err := env.kube.CoreV1().Secrets("tendo").Get(context.TODO(), "app-opaque", metav1.GetOptions{}); err == nil {
+		t.Error("opaque secret was written to the default cluster")
+	}
+
+	if got := targetStatus(t, "edge/tendo/app"); got.Cluster != "edge" || got.Result != status.ResultUpdated {
+		t.Errorf("got %s in cluster %s, want %s in edge", got.Result, got.Cluster, status.ResultUpdated)
+	}
+}
@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+)
+
+// deployedInstances returns the instances the opaque secret records as
+// running certID. Instances recorded for another certificate run an older
+// one, so none of them count.
+func deployedInstances(opaqueData map[string]string, certID string) map[string]bool {
+	deployed := map[string]bool{}
+
+	if opaqueData[OpaqueCertID] != certID || opaqueData[OpaqueDeployedInstances] == "" {
+		return deployed
+	}
+
+	for _, instance := range strings.Split(opaqueData[OpaqueDeployedInstances], ",") {
+		deployed[instance] = true
+	}
+
+	return deployed
+}
+
+// missingInstances returns the configured instances which do not run the
+// certificate yet, grouped by resource type like the configured ones.
+func missingInstances(instances []tencent.CertificateInstance, deployed map[string]bool) []tencent.CertificateInstance {
+	var missing []tencent.CertificateInstance
+
+	for _, instance := range instances {
+		var instanceIDs []string
+		for _, instanceID := range instance.InstanceIDs {
+			if !deployed[instanceKey(instance.ResourceType, instanceID)] {
+				instanceIDs = append(instanceIDs, instanceID)
+			}
+		}
+
+		if len(instanceIDs) > 0 {
+			missing = append(missing, tencent.CertificateInstance{
+				ResourceType: instance.ResourceType,
+				InstanceIDs:  instanceIDs,
+			})
+		}
+	}
+
+	return missing
+}
+
+// formatInstances encodes instances for the opaque secret, sorted so an
+// unchanged list does not update the secret.
+func formatInstances(instances []tencent.CertificateInstance) string {
+	var keys []string
+	for _, instance := range instances {
+		for _, instanceID := range instance.InstanceIDs {
+			keys = append(keys, instanceKey(instance.ResourceType, instanceID))
+		}
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
+func instanceKey(resourceType string, instanceID string) string {
+	return resourceType + "/" + instanceID
+}
+
+// recordDeployedInstances stores in the opaque secret that certID runs on
+// instances. A failure only costs a redundant deployment on the next tick,
+// so it is logged.
+func recordDeployedInstances(cluster k8s.ClusterConfig, item config.WatchConfig, certID string, instances []tencent.CertificateInstance) {
+	data := map[string]string{
+		OpaqueCertID:            certID,
+		OpaqueDeployedInstances: formatInstances(instances),
+	}
+
+	err := SyncOpaqueSecret(cluster, item.SecretNamespace, item.OpaqueSecretName, data)
+	if err != nil {
+		logger.Logger.Error(err.Error())
+	}
+}
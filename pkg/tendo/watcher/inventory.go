@@ -0,0 +1,279 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/metrics"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+)
+
+// defaultAccount names the account of the global credentials in the
+// inventory.
+const defaultAccount = "default"
+
+// thresholdExpired flags certificates which have expired already.
+const thresholdExpired = "expired"
+
+var (
+	inventoryCertificates = metrics.NewGaugeVec(
+		"tendo_inventory_certificates",
+		"Issued and expired certificates found by the last inventory of an account.",
+		"account",
+	)
+	inventoryExpiring = metrics.NewGaugeVec(
+		"tendo_inventory_certificates_expiring",
+		"Certificates of an account expiring within the threshold, expired ones included.",
+		"account", "threshold",
+	)
+	inventoryExpiry = metrics.NewGaugeVec(
+		"tendo_inventory_certificate_expiry_timestamp_seconds",
+		"Expiry of every certificate found by the inventory as a unix timestamp.",
+		"account", "certificate_id", "alias", "domain", "managed",
+	)
+	inventoryErrors = metrics.NewCounterVec(
+		"tendo_inventory_errors_total",
+		"Inventory runs of an account which failed.",
+		"account",
+	)
+)
+
+var (
+	inventoryMu sync.Mutex
+	// lastInventory keeps the certificates of every account, so the metrics
+	// of an account survive a failed run of another one
+	lastInventory = map[string][]tencent.InventoryCertificate{}
+)
+
+// StartInventory takes the certificate inventory of every account on the
+// inventory interval until ctx is done.
+func StartInventory(ctx context.Context, c *config.Config, kubeconfig string) {
+	tick := time.NewTicker(c.Inventory.Interval)
+	defer tick.Stop()
+
+	for {
+		RunInventory(ctx, c, kubeconfig)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// RunInventory lists the certificates of every account and publishes them
+// through logs, metrics and the status API.
+func RunInventory(ctx context.Context, c *config.Config, kubeconfig string) {
+	for _, account := range inventoryAccounts(c) {
+		name := account
+		if name == "" {
+			name = defaultAccount
+		}
+
+		certificates, err := listAccountInventory(ctx, c, kubeconfig, account)
+		if err != nil {
+			logger.Logger.Error(fmt.Sprintf("unable to take certificate inventory of account %s with error: %s", name, err))
+			inventoryErrors.Inc(name)
+
+			if tencent.IsAuthFailure(err) {
+				InvalidateCredentials(account)
+			}
+
+			// keep the certificates of the last good run, updatedAt tells
+			// how old they are
+			previous, _ := status.Inventory(name)
+			previous.Account = name
+			previous.Message = err.Error()
+
+			status.SetInventory(previous)
+			continue
+		}
+
+		inventoryMu.Lock()
+		lastInventory[name] = certificates
+		inventoryMu.Unlock()
+
+		expiring := flagExpiring(certificates, c.Inventory.Thresholds, time.Now())
+		for _, cert := range expiring {
+			bound := "no resources"
+			if len(cert.BoundResources) > 0 {
+				bound = strings.Join(cert.BoundResources, ", ")
+			}
+
+			logger.Logger.Warn(fmt.Sprintf("certificate %s of account %s with alias %s for %s expires at %s, within %s, managed by tendo: %t, bound to %s", cert.CertificateID, name, cert.Alias, cert.Domain, cert.ExpiresAt.Format(time.RFC3339), cert.Threshold, cert.Managed, bound))
+		}
+
+		logger.Logger.Info(fmt.Sprintf("certificate inventory of account %s found %d certificates, %d expiring", name, len(certificates), len(expiring)))
+
+		status.SetInventory(status.AccountInventory{
+			Account:      name,
+			Certificates: len(certificates),
+			Expiring:     expiring,
+		})
+	}
+
+	publishInventoryMetrics(c.Inventory.Thresholds, time.Now())
+}
+
+// inventoryAccounts returns the named accounts, and the global credentials
+// when a watch target uses them or no account is configured.
+func inventoryAccounts(c *config.Config) []string {
+	var accounts []string
+
+	useDefault := len(c.Accounts) == 0
+	for _, item := range c.WatchTargets {
+		if item.Account == "" {
+			useDefault = true
+		}
+	}
+
+	if useDefault {
+		accounts = append(accounts, "")
+	}
+
+	for _, account := range c.Accounts {
+		accounts = append(accounts, account.Name)
+	}
+
+	return accounts
+}
+
+func listAccountInventory(ctx context.Context, c *config.Config, kubeconfig string, account string) ([]tencent.InventoryCertificate, error) {
+	tencentCreds, err := ResolveCredentials(c, kubeconfig, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ssl certificate api is not regional
+	tencentSSLCertificate := tencent.TencentSSLCertificate{
+		Context:       ctx,
+		Credentials:   tencentCreds,
+		ClientOptions: clientOptions(c.Tencent),
+	}
+
+	client, err := tencentSSLCertificate.BuildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := tencentSSLCertificate.ListInventory(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// certificates uploaded before tagging are known by the alias of their
+	// watch target
+	for i := range certificates {
+		for _, item := range c.WatchTargets {
+			if item.Account == account && item.CertificateName != "" && certificates[i].Alias == item.CertificateName {
+				certificates[i].Managed = true
+			}
+		}
+	}
+
+	return certificates, nil
+}
+
+// flagExpiring returns the certificates which expired or expire within one
+// of the thresholds, each flagged with the tightest threshold it falls in.
+func flagExpiring(certificates []tencent.InventoryCertificate, thresholds []time.Duration, now time.Time) []status.ExpiringCertificate {
+	sorted := append([]time.Duration{}, thresholds...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var expiring []status.ExpiringCertificate
+	for _, cert := range certificates {
+		if cert.ExpiresAt.IsZero() {
+			continue
+		}
+
+		threshold := ""
+		if cert.Expired(now) {
+			threshold = thresholdExpired
+		} else {
+			for _, value := range sorted {
+				if cert.ExpiresAt.Sub(now) <= value {
+					threshold = formatThreshold(value)
+					break
+				}
+			}
+		}
+
+		if threshold == "" {
+			continue
+		}
+
+		expiring = append(expiring, status.ExpiringCertificate{
+			CertificateID:  cert.CertificateID,
+			Alias:          cert.Alias,
+			Domain:         cert.Domain,
+			ExpiresAt:      cert.ExpiresAt,
+			Threshold:      threshold,
+			BoundResources: cert.BoundResources,
+			Managed:        cert.Managed,
+		})
+	}
+
+	return expiring
+}
+
+// publishInventoryMetrics replaces the inventory metrics with the last
+// inventory of every account.
+func publishInventoryMetrics(thresholds []time.Duration, now time.Time) {
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+
+	inventoryCertificates.Reset()
+	inventoryExpiring.Reset()
+	inventoryExpiry.Reset()
+
+	for account, certificates := range lastInventory {
+		inventoryCertificates.Set(float64(len(certificates)), account)
+
+		expired := 0
+		for _, cert := range certificates {
+			if cert.ExpiresAt.IsZero() {
+				continue
+			}
+
+			if cert.Expired(now) {
+				expired++
+			}
+
+			inventoryExpiry.Set(float64(cert.ExpiresAt.Unix()), account, cert.CertificateID, cert.Alias, cert.Domain, strconv.FormatBool(cert.Managed))
+		}
+		inventoryExpiring.Set(float64(expired), account, thresholdExpired)
+
+		for _, threshold := range thresholds {
+			count := 0
+			for _, cert := range certificates {
+				if !cert.ExpiresAt.IsZero() && cert.ExpiresAt.Sub(now) <= threshold {
+					count++
+				}
+			}
+
+			inventoryExpiring.Set(float64(count), account, formatThreshold(threshold))
+		}
+	}
+}
+
+// formatThreshold renders whole days as "30d" and other durations as Go
+// durations, e.g. "12h0m0s".
+func formatThreshold(threshold time.Duration) string {
+	day := 24 * time.Hour
+	if threshold%day == 0 {
+		return fmt.Sprintf("%dd", threshold/day)
+	}
+
+	return threshold.String()
+}
@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tendo/metrics"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+)
+
+func TestFlagExpiring(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	certificates := []tencent.InventoryCertificate{
+		{CertificateID: "expired", ExpiresAt: now.Add(-day)},
+		{CertificateID: "in-3-days", ExpiresAt: now.Add(3 * day), BoundResources: []string{"clb"}},
+		{CertificateID: "in-7-days", ExpiresAt: now.Add(7 * day)},
+		{CertificateID: "in-20-days", ExpiresAt: now.Add(20 * day), Managed: true},
+		{CertificateID: "in-60-days", ExpiresAt: now.Add(60 * day)},
+		{CertificateID: "pending"},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds []time.Duration
+		want       map[string]string
+	}{
+		{
+			name:       "tightest threshold wins",
+			thresholds: []time.Duration{30 * day, 7 * day},
+			want: map[string]string{
+				"expired":    thresholdExpired,
+				"in-3-days":  "7d",
+				"in-7-days":  "7d",
+				"in-20-days": "30d",
+			},
+		},
+		{
+			name:       "thresholds in any order",
+			thresholds: []time.Duration{7 * day, 30 * day},
+			want: map[string]string{
+				"expired":    thresholdExpired,
+				"in-3-days":  "7d",
+				"in-7-days":  "7d",
+				"in-20-days": "30d",
+			},
+		},
+		{
+			name:       "threshold nothing falls in",
+			thresholds: []time.Duration{90 * 24 * time.Hour, 36 * time.Hour},
+			want: map[string]string{
+				"expired":    thresholdExpired,
+				"in-3-days":  "90d",
+				"in-7-days":  "90d",
+				"in-20-days": "90d",
+				"in-60-days": "90d",
+			},
+		},
+		{
+			name: "expired only without thresholds",
+			want: map[string]string{
+				"expired": thresholdExpired,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, cert := range flagExpiring(certificates, test.thresholds, now) {
+				got[cert.CertificateID] = cert.Threshold
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	t.Run("flagged certificates keep their details", func(t *testing.T) {
+		expiring := flagExpiring(certificates[1:4], []time.Duration{30 * day}, now)
+		if len(expiring) != 3 {
+			t.Fatalf("got %d certificates, want 3", len(expiring))
+		}
+
+		if !reflect.DeepEqual(expiring[0].BoundResources, []string{"clb"}) || !expiring[2].Managed {
+			t.Errorf("got %+v, want bound resources and managed flags kept", expiring)
+		}
+	})
+}
+
+func TestRunInventory(t *testing.T) {
+	env := newTestEnvironment(t)
+	env.config.Inventory.Thresholds = []time.Duration{30 * 24 * time.Hour}
+
+	for _, value := range []struct {
+		alias     string
+		expiresIn time.Duration
+	}{
+		{alias: "expiring", expiresIn: 10 * 24 * time.Hour},
+		{alias: "current", expiresIn: 200 * 24 * time.Hour},
+	} {
+		certPEM, keyPEM := testCertificate(t, value.alias+".example.com")
+		env.ssl.AddCertificate(fake.Certificate{
+			Alias:       value.alias,
+			PublicKey:   certPEM,
+			PrivateKey:  keyPEM,
+			Status:      fake.CertificateStatusIssued,
+			CertEndTime: time.Now().Add(value.expiresIn),
+		})
+	}
+
+	RunInventory(context.Background(), env.config, "")
+
+	inventory, ok := status.Inventory("test")
+	if !ok || inventory.Certificates != 2 || inventory.Message != "" {
+		t.Fatalf("got inventory %+v, want 2 certificates", inventory)
+	}
+
+	if len(inventory.Expiring) != 1 || inventory.Expiring[0].Alias != "expiring" || inventory.Expiring[0].Threshold != "30d" {
+		t.Fatalf("got expiring %+v, want the expiring certificate within 30d", inventory.Expiring)
+	}
+
+	t.Run("failed run keeps the last good inventory", func(t *testing.T) {
+		errors := metricValue(t, `tendo_inventory_errors_total{account="test"}`)
+
+		env.ssl.InjectError("DescribeCertificates", "InvalidParameter", "inventory is unavailable", 0)
+
+		RunInventory(context.Background(), env.config, "")
+
+		failed, _ := status.Inventory("test")
+		if failed.Certificates != 2 || len(failed.Expiring) != 1 {
+			t.Errorf("got inventory %+v, want the certificates of the last good run", failed)
+		}
+
+		if !strings.Contains(failed.Message, "InvalidParameter") {
+			t.Errorf("got message %q, want the error of the failed run", failed.Message)
+		}
+
+		for metric, want := range map[string]float64{
+			`tendo_inventory_certificates{account="test"}`:                          2,
+			`tendo_inventory_certificates_expiring{account="test",threshold="30d"}`: 1,
+			`tendo_inventory_errors_total{account="test"}`:                          errors + 1,
+		} {
+			if got := metricValue(t, metric); got != want {
+				t.Errorf("got %s %g, want %g", metric, got, want)
+			}
+		}
+	})
+}
+
+// metricValue reads a sample from the metrics endpoint, 0 when it is not
+// exposed.
+func metricValue(t *testing.T, metric string) float64 {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, line := range strings.Split(response.Body.String(), "\n") {
+		value, found := strings.CutPrefix(line, metric+" ")
+		if !found {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	return 0
+}
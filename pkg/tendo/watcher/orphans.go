@@ -0,0 +1,167 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+)
+
+// AccountOrphans are the orphaned certificates found in one account.
+type AccountOrphans struct {
+	Account string
+	Orphans []tencent.OrphanCertificate
+}
+
+// ScanOrphans lists the certificates tendo uploaded or applied for in every
+// account which no current watch target needs anymore. Nothing is deleted,
+// see DeleteOrphans.
+func ScanOrphans(ctx context.Context, c *config.Config, kubeconfig string) ([]AccountOrphans, error) {
+	configureRateLimits(c.Tencent.RateLimit)
+
+	var result []AccountOrphans
+	var errs []error
+
+	for _, account := range inventoryAccounts(c) {
+		name := account
+		if name == "" {
+			name = defaultAccount
+		}
+
+		owners, err := orphanOwners(c, kubeconfig, account)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", name, err))
+			continue
+		}
+
+		certificates, err := listAccountInventory(ctx, c, kubeconfig, account)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", name, err))
+			continue
+		}
+
+		orphans := tencent.FindOrphans(certificates, owners, knownClusters(c), time.Now())
+		logger.Logger.Info(fmt.Sprintf("found %d orphaned certificates among %d certificates of account %s", len(orphans), len(certificates), name))
+
+		result = append(result, AccountOrphans{
+			Account: name,
+			Orphans: orphans,
+		})
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// DeleteOrphans deletes the orphaned certificates found by ScanOrphans.
+func DeleteOrphans(ctx context.Context, c *config.Config, kubeconfig string, accounts []AccountOrphans) error {
+	var errs []error
+
+	for _, account := range accounts {
+		if len(account.Orphans) == 0 {
+			continue
+		}
+
+		name := account.Account
+		if name == defaultAccount {
+			name = ""
+		}
+
+		tencentCreds, err := ResolveCredentials(c, kubeconfig, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Account, err))
+			continue
+		}
+
+		tencentSSLCertificate := tencent.TencentSSLCertificate{
+			Context:       ctx,
+			Account:       name,
+			Credentials:   tencentCreds,
+			ClientOptions: clientOptions(c.Tencent),
+		}
+
+		client, err := tencentSSLCertificate.BuildClient()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Account, err))
+			continue
+		}
+
+		deleted, err := tencentSSLCertificate.DeleteOrphans(client, account.Orphans)
+		for _, certID := range deleted {
+			logger.Logger.Info(fmt.Sprintf("deleted orphaned certificate %s of account %s", certID, account.Account))
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Account, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// orphanOwners returns the certificate names the watch targets of an account
+// manage. Pull targets only read certificates, so they own none.
+func orphanOwners(c *config.Config, kubeconfig string, account string) ([]tencent.OrphanOwner, error) {
+	var owners []tencent.OrphanOwner
+
+	for _, item := range c.WatchTargets {
+		if item.Account != account || item.CertificateName == "" {
+			continue
+		}
+
+		if item.Mode == config.ModePull {
+			continue
+		}
+
+		cluster, err := ResolveCluster(c, kubeconfig, item.Cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		retention := tencent.RetentionPolicy{
+			Keep:        item.Retention.Keep,
+			GracePeriod: item.Retention.GracePeriod,
+		}
+
+		owner := tencent.OrphanOwner{
+			CertificateName: item.CertificateName,
+			Retention:       retention,
+		}
+
+		if item.Mode != config.ModePull {
+			owner.Tags = tencent.ProvenanceTags(cluster.Name, item.SecretNamespace, item.SecretName)
+		}
+
+		owners = append(owners, owner)
+
+		// superseded ca certificates are never deleted by the watcher since
+		// listeners outside the watch target may use them, the bound ones
+		// are kept here as well
+		if item.UploadCACertificate {
+			caCertificate := tencent.TencentSSLCertificate{CertificateName: item.CertificateName}
+			owners = append(owners, tencent.OrphanOwner{
+				CertificateName: caCertificate.CAAlias(),
+				Tags:            owner.Tags,
+				Retention:       retention,
+			})
+		}
+	}
+
+	return owners, nil
+}
+
+// knownClusters returns the names of the clusters configured explicitly,
+// tagged certificates of other clusters belong to other tendo installations.
+// Every installation without clusters tags its certificates with the default
+// cluster, so without clusters no tag can be trusted and none is returned.
+func knownClusters(c *config.Config) []string {
+	var clusters []string
+	for _, cluster := range c.Clusters {
+		clusters = append(clusters, cluster.Name)
+	}
+
+	return clusters
+}
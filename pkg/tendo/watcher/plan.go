@@ -0,0 +1,421 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+)
+
+// newCertificate stands in for the id of a certificate a run would upload.
+const newCertificate = "<new certificate>"
+
+// runAction is one change of a run, described for dry runs and the status
+// API.
+type runAction struct {
+	description string
+	run         func() error
+}
+
+// runPlan is the list of changes a run of a target makes, built from its
+// reads and comparisons before anything is changed. A run executes it, a
+// dry run reports it. certID and result are updated by the actions as they
+// run, prunes is set when the plan looked for versions to prune.
+type runPlan struct {
+	target  string
+	certID  string
+	result  string
+	prunes  bool
+	actions []runAction
+}
+
+func newRunPlan(cluster k8s.ClusterConfig, item config.WatchConfig, certID string) *runPlan {
+	return &runPlan{
+		target: targetName(cluster, item),
+		certID: certID,
+		result: status.ResultUpToDate,
+	}
+}
+
+func (p *runPlan) add(description string, run func() error) {
+	p.actions = append(p.actions, runAction{
+		description: description,
+		run:         run,
+	})
+}
+
+// execute runs the actions in order and stops at the first failing one.
+func (p *runPlan) execute() error {
+	for _, action := range p.actions {
+		err := action.run()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// report publishes the plan of a dry run on the status API, a target with
+// nothing to change is up to date.
+func (p *runPlan) report(cluster k8s.ClusterConfig) {
+	var planned []string
+	for _, action := range p.actions {
+		logger.Logger.Info(fmt.Sprintf("dry run of %s would %s", p.target, action.description))
+		planned = append(planned, action.description)
+	}
+
+	result := status.ResultDryRun
+	if len(planned) == 0 {
+		logger.Logger.Info(fmt.Sprintf("dry run of %s found nothing to change", p.target))
+		result = status.ResultUpToDate
+	}
+
+	status.SetTarget(status.TargetStatus{
+		Target:        p.target,
+		Cluster:       cluster.Name,
+		CertificateID: p.certID,
+		Result:        result,
+		Planned:       planned,
+	})
+}
+
+// planPush does the reads and comparisons of RunLoop and adds what it
+// uploads, deploys, binds and deletes to plan.
+func planPush(plan *runPlan, cluster k8s.ClusterConfig, item config.WatchConfig, t *tencent.TencentSSLCertificate, client tencent.SSLClient, secret SecretData, secretFingerprint tencent.CertificateFingerprint, encryptFingerprint tencent.CertificateFingerprint) error {
+	created := false
+	if t.CertificateID == "" {
+		certID, err := t.GetCertificateID(client)
+
+		certNotFoundError := &tencent.CertificateNotFoundError{}
+		if errors.As(err, &certNotFoundError) {
+			created = true
+		} else if err != nil {
+			return err
+		}
+
+		t.CertificateID = certID
+		plan.certID = certID
+	}
+
+	certChanged := false
+	if created {
+		logger.Logger.Info(fmt.Sprintf("certificate with name %s not found", t.CertificateName))
+
+		plan.certID = newCertificate
+		plan.add(fmt.Sprintf("upload certificate %s", t.CertificateName), func() error {
+			certID, err := t.CreateCertificate(client)
+			if err != nil {
+				return err
+			}
+
+			t.CertificateID = certID
+			plan.certID = certID
+			plan.result = status.ResultUpdated
+			return nil
+		})
+	} else {
+		// compare secret with cert by leaf fingerprint, serial and public key
+		cert, err := t.GetCertificateDetail(client)
+		if err != nil {
+			return err
+		}
+
+		certChanged = !secretFingerprint.Equal(cert.Fingerprint)
+		if item.SM2 != nil && !encryptFingerprint.Equal(cert.EncryptFingerprint) {
+			certChanged = true
+		}
+	}
+
+	// instances which do not run the certificate yet, after a failed first
+	// deployment or when instanceIds were added since, read before the
+	// opaque secret moves on to the current certificate
+	missing := t.CertificateInstances
+	if !created && !certChanged && len(t.CertificateInstances) > 0 {
+		deployedData, err := GetOpaqueSecret(cluster, item.SecretNamespace, item.OpaqueSecretName)
+		if err != nil {
+			return err
+		}
+
+		missing = missingInstances(t.CertificateInstances, deployedInstances(deployedData, plan.certID))
+	}
+
+	opaqueData := map[string]string{
+		OpaqueCertID: plan.certID,
+	}
+
+	// the ca certificate is synced before any binding, so listeners are
+	// switched to it together with the certificate
+	caChanged := false
+	if item.UploadCACertificate {
+		if secret.CACertificate == "" {
+			err := fmt.Errorf("secret %s has no ca.crt to upload as ca certificate", item.SecretName)
+			return err
+		}
+
+		caCertID, superseded, err := t.FindCACertificate(client)
+		if err != nil {
+			return err
+		}
+
+		if caCertID == "" {
+			caCertID = newCertificate
+			caChanged = true
+			plan.add(fmt.Sprintf("upload ca certificate %s", t.CAAlias()), func() error {
+				_, err := t.CreateCACertificate(client)
+				if err != nil {
+					return err
+				}
+
+				plan.result = status.ResultUpdated
+				return nil
+			})
+		} else {
+			t.CACertificateID = caCertID
+		}
+
+		for _, supersededID := range superseded {
+			plan.add(fmt.Sprintf("keep superseded ca certificate %s as a version of %s", supersededID, t.CAAlias()), func() error {
+				err := t.RetireCACertificate(client, supersededID)
+				if err != nil {
+					logger.Logger.Error(err.Error())
+				}
+				return nil
+			})
+		}
+
+		opaqueData[OpaqueCACertID] = caCertID
+	}
+
+	// create the opaque secret if not exists and keep its ids up to date
+	action, err := PlanOpaqueSecret(cluster, item.SecretNamespace, item.OpaqueSecretName, opaqueData)
+	if err != nil {
+		logger.Logger.Error(err.Error())
+		action = fmt.Sprintf("sync opaque secret %s/%s in cluster %s", item.SecretNamespace, item.OpaqueSecretName, cluster.Name)
+	}
+
+	if action != "" {
+		plan.add(action, func() error {
+			data := map[string]string{
+				OpaqueCertID: t.CertificateID,
+			}
+			if item.UploadCACertificate {
+				data[OpaqueCACertID] = t.CACertificateID
+			}
+
+			err := SyncOpaqueSecret(cluster, item.SecretNamespace, item.OpaqueSecretName, data)
+			if err != nil {
+				logger.Logger.Error(err.Error())
+			}
+			return nil
+		})
+	}
+
+	switch {
+	case created:
+		planInstances(plan, cluster, item, t, client, missing)
+		planCLBListeners(plan, t, t.CLBListeners)
+
+	case !certChanged:
+		logger.Logger.Info(fmt.Sprintf("certificate in secret %s is up to date with certificate stored in tencent cloud", item.SecretName))
+
+		planInstances(plan, cluster, item, t, client, missing)
+
+		// a new ca certificate is only known once uploaded, every listener
+		// is switched to it
+		if caChanged {
+			planCLBListeners(plan, t, t.CLBListeners)
+		} else {
+			// listeners may have been created or changed since the last
+			// update
+			unbound, err := t.UnboundCLBListeners(plan.certID)
+			if err != nil {
+				return err
+			}
+
+			planCLBListeners(plan, t, unbound)
+		}
+
+		// superseded versions may have outlived their grace period since the
+		// last deployment, RunLoop marks them pruned once the plan ran
+		if pruneDue(plan.target) {
+			plan.prunes = true
+
+			prunable, err := t.PrunableCertificates(client)
+			if err != nil {
+				logger.Logger.Error(fmt.Sprintf("unable to list superseded certificates of %s with error: %s", item.CertificateName, err))
+			}
+
+			for _, version := range prunable {
+				plan.add(fmt.Sprintf("prune certificate %s superseded at %s", version.CertificateID, version.SupersededAt.Format(time.RFC3339)), func() error {
+					_, err := t.DeleteCertificate(client, version.CertificateID)
+					if err != nil {
+						logger.Logger.Error(fmt.Sprintf("unable to prune superseded certificate %s of %s with error: %s", version.CertificateID, item.CertificateName, err))
+					}
+					return nil
+				})
+			}
+		}
+
+	// explicit instances get a brand-new certificate instead of an in-place
+	// update of every resource holding the current one
+	case len(t.CertificateInstances) > 0:
+		logger.Logger.Info(fmt.Sprintf("certificate in secret %s is not matched with certificated stored in tencent cloud with name %s", item.SecretName, item.CertificateName))
+
+		oldCertID := plan.certID
+		description := fmt.Sprintf("upload certificate %s as a new certificate, deploy it to %s, discarding it if a deployment fails, then %s", t.CertificateName, formatInstanceList(t.CertificateInstances), retireDescription(t, oldCertID))
+		plan.add(description, func() error {
+			newCertID, err := t.ReplaceOnInstances(client)
+			if err != nil {
+				return err
+			}
+
+			recordDeployedInstances(cluster, item, newCertID, t.CertificateInstances)
+			plan.certID = newCertID
+			plan.result = status.ResultUpdated
+			return nil
+		})
+
+		planCLBListeners(plan, t, t.CLBListeners)
+
+	default:
+		logger.Logger.Info(fmt.Sprintf("certificate in secret %s is not matched with certificated stored in tencent cloud with name %s", item.SecretName, item.CertificateName))
+
+		var resourceTypes []string
+		for _, resourceType := range t.CertificateResourceTypes {
+			if len(resourceType.Regions) == 0 {
+				resourceTypes = append(resourceTypes, resourceType.Name)
+				continue
+			}
+
+			resourceTypes = append(resourceTypes, fmt.Sprintf("%s in %s", resourceType.Name, strings.Join(resourceType.Regions, ", ")))
+		}
+
+		oldCertID := plan.certID
+		description := fmt.Sprintf("update certificate %s in place and deploy it to %s, rolling back to %s if a deploy record fails, then %s", oldCertID, strings.Join(resourceTypes, "; "), oldCertID, retireDescription(t, oldCertID))
+		plan.add(description, func() error {
+			err := t.UpdateCertificateDetail(client)
+			if err != nil {
+				return err
+			}
+
+			// wait for 5 seconds, for deployment started
+			time.Sleep(5 * time.Second)
+
+			newCertID, err := t.WatchCertificateUpdateStatus(client)
+			if err != nil {
+				return err
+			}
+
+			plan.certID = newCertID
+			plan.result = status.ResultUpdated
+			return nil
+		})
+
+		planCLBListeners(plan, t, t.CLBListeners)
+	}
+
+	return nil
+}
+
+// planPull does the reads and comparisons of RunPullLoop and adds whether it
+// writes the secret to plan.
+func planPull(plan *runPlan, cluster k8s.ClusterConfig, item config.WatchConfig, t *tencent.TencentSSLCertificate, client tencent.SSLClient) error {
+	certID, err := t.FindLatestCertificate(client)
+	if err != nil {
+		return err
+	}
+
+	plan.certID = certID
+
+	download, err := t.DownloadCertificate(client, plan.certID)
+	if err != nil {
+		return err
+	}
+
+	action, err := PlanTLSSecret(cluster, item.SecretNamespace, item.SecretName, plan.certID, download.PublicKey, download.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	if action != "" {
+		plan.add(action, func() error {
+			return syncTLSSecret(plan, cluster, item, download)
+		})
+	}
+
+	return nil
+}
+
+func syncTLSSecret(plan *runPlan, cluster k8s.ClusterConfig, item config.WatchConfig, download tencent.CertificateDownload) error {
+	changed, err := SyncTLSSecret(cluster, item.SecretNamespace, item.SecretName, plan.certID, download.PublicKey, download.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		plan.result = status.ResultUpdated
+	}
+	return nil
+}
+
+// planInstances adds the deployment of the certificate to instances which
+// do not run it yet.
+func planInstances(plan *runPlan, cluster k8s.ClusterConfig, item config.WatchConfig, t *tencent.TencentSSLCertificate, client tencent.SSLClient, missing []tencent.CertificateInstance) {
+	if len(missing) == 0 {
+		return
+	}
+
+	plan.add(fmt.Sprintf("deploy certificate %s to %s", plan.certID, formatInstanceList(missing)), func() error {
+		err := t.DeployToInstances(client, plan.certID, "", missing)
+		if err != nil {
+			return err
+		}
+
+		recordDeployedInstances(cluster, item, plan.certID, t.CertificateInstances)
+		plan.result = status.ResultUpdated
+		return nil
+	})
+}
+
+// planCLBListeners adds the binding of the certificate to listeners, the
+// certificate is the one of the plan when the binding runs.
+func planCLBListeners(plan *runPlan, t *tencent.TencentSSLCertificate, listeners []tencent.CLBListener) {
+	if len(listeners) == 0 {
+		return
+	}
+
+	var names []string
+	for _, listener := range listeners {
+		names = append(names, fmt.Sprintf("%s in %s", listener, listener.Region))
+	}
+
+	plan.add(fmt.Sprintf("bind the certificate to clb listeners %s", strings.Join(names, ", ")), func() error {
+		return t.BindCLBListeners(plan.certID)
+	})
+}
+
+// retireDescription describes what RetireCertificate does with the replaced
+// certificate.
+func retireDescription(t *tencent.TencentSSLCertificate, certID string) string {
+	if t.Retention.Enabled() {
+		return fmt.Sprintf("keep superseded certificate %s as a version of %s", certID, t.CertificateName)
+	}
+
+	return fmt.Sprintf("delete superseded certificate %s", certID)
+}
+
+func formatInstanceList(instances []tencent.CertificateInstance) string {
+	var groups []string
+	for _, instance := range instances {
+		groups = append(groups, fmt.Sprintf("%s instances %s", instance.ResourceType, strings.Join(instance.InstanceIDs, ", ")))
+	}
+
+	return strings.Join(groups, "; ")
+}
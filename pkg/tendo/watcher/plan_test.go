@@ -0,0 +1,518 @@
+package watcher
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tencent/fake"
+	"github.com/fredytarigan/Tendo/pkg/tencent/resourcetype"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+	"go.uber.org/zap"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMain(m *testing.M) {
+	// main configures the logger from config.yaml, tests have none
+	logger.Logger = zap.NewNop()
+
+	os.Exit(m.Run())
+}
+
+// testCertificate returns a self-signed certificate for domain and its
+// private key, both PEM encoded.
+func testCertificate(t *testing.T, domain string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return string(certPEM), string(keyPEM)
+}
+
+// testEnvironment is a fake default cluster and fake Tencent Cloud SSL and
+// CLB APIs, used by every watcher call for the duration of a test.
+type testEnvironment struct {
+	kube   *k8sfake.Clientset
+	ssl    *fake.SSLClient
+	clb    *fake.CLBClient
+	config *config.Config
+}
+
+func newTestEnvironment(t *testing.T, objects ...runtime.Object) *testEnvironment {
+	t.Helper()
+
+	objects = append(objects, &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tencent-credentials", Namespace: "tendo"},
+		Data: map[string][]byte{
+			DefaultSecretIDKey:  []byte("AKIDtendotest"),
+			DefaultSecretKeyKey: []byte("tendo-test-secret"),
+		},
+	})
+
+	env := &testEnvironment{
+		kube: k8sfake.NewSimpleClientset(objects...),
+		ssl:  fake.NewSSLClient(),
+		config: &config.Config{
+			Accounts: []config.AccountConfig{{
+				Name:      "test",
+				SecretRef: &config.SecretRefConfig{Namespace: "tendo", Name: "tencent-credentials"},
+			}},
+		},
+	}
+	env.clb = fake.NewCLBClient(env.ssl)
+
+	k8s.ClusterClientFactory = func(cluster k8s.ClusterConfig) (kubernetes.Interface, error) {
+		return env.kube, nil
+	}
+	tencent.SSLClientFactory = func(target *tencent.TencentSSLCertificate) (tencent.SSLClient, error) {
+		return env.ssl, nil
+	}
+	tencent.CLBClientFactory = func(target *tencent.TencentSSLCertificate, region string) (tencent.CLBClient, error) {
+		return env.clb, nil
+	}
+
+	// credentials cached by an earlier test were read from another cluster,
+	// and targets it pruned are not due again
+	cached := credentials
+	credentials = tencent.NewCredentialManager()
+
+	pruneMu.Lock()
+	lastPruned = map[string]time.Time{}
+	pruneMu.Unlock()
+
+	t.Cleanup(func() {
+		k8s.ClusterClientFactory = nil
+		tencent.SSLClientFactory = nil
+		tencent.CLBClientFactory = nil
+		credentials = cached
+	})
+
+	return env
+}
+
+// addSecret stores a kubernetes.io/tls secret in the tendo namespace.
+func (env *testEnvironment) addSecret(t *testing.T, name string, data map[string]string) {
+	t.Helper()
+
+	secret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tendo"},
+		Type:       apiv1.SecretTypeTLS,
+		Data:       map[string][]byte{},
+	}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+
+	_, err := env.kube.CoreV1().Secrets("tendo").Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// target returns a push target of the test account for the secret name,
+// with an opaque secret of the same name suffixed "-opaque".
+func (env *testEnvironment) target(name string) config.WatchConfig {
+	return config.WatchConfig{
+		Mode:             config.ModePush,
+		Account:          "test",
+		SecretName:       name,
+		SecretNamespace:  "tendo",
+		OpaqueSecretName: name + "-opaque",
+		CertificateName:  name,
+	}
+}
+
+// writes lists the changes made in the fake cluster.
+func (env *testEnvironment) writes() []string {
+	var writes []string
+	for _, action := range env.kube.Actions() {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+		default:
+			writes = append(writes, fmt.Sprintf("%s %s", action.GetVerb(), action.GetResource().Resource))
+		}
+	}
+
+	return writes
+}
+
+// secretData returns the data of a secret in the tendo namespace, the fake
+// clientset keeps StringData as written instead of merging it into Data.
+func (env *testEnvironment) secretData(t *testing.T, name string) map[string]string {
+	t.Helper()
+
+	secret, err := env.kube.CoreV1().Secrets("tendo").Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]string{}
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	for key, value := range secret.StringData {
+		data[key] = value
+	}
+
+	return data
+}
+
+// targetStatus returns the status a run published for a target.
+func targetStatus(t *testing.T, name string) status.TargetStatus {
+	t.Helper()
+
+	for _, target := range status.Snapshot().Targets {
+		if target.Target == name {
+			return target
+		}
+	}
+
+	t.Fatalf("no status published for %s", name)
+	return status.TargetStatus{}
+}
+
+func containsPrefix(values []string, prefix string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestRunPlan(t *testing.T) {
+	cluster := k8s.ClusterConfig{Name: DefaultClusterName}
+
+	t.Run("execute stops at the first failing action", func(t *testing.T) {
+		plan := newRunPlan(cluster, config.WatchConfig{SecretNamespace: "tendo", SecretName: "execute"}, "")
+
+		var ran []string
+		plan.add("first", func() error {
+			ran = append(ran, "first")
+			return nil
+		})
+		plan.add("second", func() error {
+			ran = append(ran, "second")
+			return errors.New("second failed")
+		})
+		plan.add("third", func() error {
+			ran = append(ran, "third")
+			return nil
+		})
+
+		err := plan.execute()
+		if err == nil || err.Error() != "second failed" {
+			t.Fatalf("got error %v, want the error of the second action", err)
+		}
+
+		if !reflect.DeepEqual(ran, []string{"first", "second"}) {
+			t.Errorf("ran %v, want first and second", ran)
+		}
+	})
+
+	t.Run("report publishes the actions without running them", func(t *testing.T) {
+		plan := newRunPlan(cluster, config.WatchConfig{SecretNamespace: "tendo", SecretName: "report"}, "OLDID")
+
+		ran := false
+		for _, description := range []string{"upload certificate report", "delete superseded certificate OLDID"} {
+			plan.add(description, func() error {
+				ran = true
+				return nil
+			})
+		}
+
+		plan.report(cluster)
+
+		if ran {
+			t.Error("report ran an action")
+		}
+
+		got := targetStatus(t, "default/tendo/report")
+		want := []string{"upload certificate report", "delete superseded certificate OLDID"}
+		if got.Result != status.ResultDryRun || got.CertificateID != "OLDID" || !reflect.DeepEqual(got.Planned, want) {
+			t.Errorf("got %s of %s planning %v, want %s of OLDID planning %v", got.Result, got.CertificateID, got.Planned, status.ResultDryRun, want)
+		}
+	})
+
+	t.Run("empty plan is up to date", func(t *testing.T) {
+		plan := newRunPlan(cluster, config.WatchConfig{SecretNamespace: "tendo", SecretName: "empty"}, "CERTID")
+		plan.report(cluster)
+
+		got := targetStatus(t, "default/tendo/empty")
+		if got.Result != status.ResultUpToDate || len(got.Planned) != 0 {
+			t.Errorf("got %s planning %v, want %s", got.Result, got.Planned, status.ResultUpToDate)
+		}
+	})
+}
+
+func TestRunLoopDryRun(t *testing.T) {
+	t.Run("outdated certificate is only planned", func(t *testing.T) {
+		env := newTestEnvironment(t)
+		env.config.DryRun = true
+
+		oldPEM, oldKey := testCertificate(t, "outdated.example.com")
+		newPEM, newKey := testCertificate(t, "outdated.example.com")
+		env.addSecret(t, "outdated", map[string]string{"tls.crt": newPEM, "tls.key": newKey})
+
+		oldCertID := env.ssl.AddCertificate(fake.Certificate{
+			Alias:      "outdated",
+			PublicKey:  oldPEM,
+			PrivateKey: oldKey,
+			Status:     fake.CertificateStatusIssued,
+			Tags:       tencent.ProvenanceTags(DefaultClusterName, "tendo", "outdated"),
+		})
+		env.clb.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", CertID: oldCertID})
+
+		item := env.target("outdated")
+		item.CertificateResourceTypes = []config.CertificateResourceType{{Name: resourcetype.ResourceType("clb"), Regions: []string{"ap-singapore"}}}
+		item.CLBListeners = []config.CLBListener{{Region: "ap-singapore", LoadBalancerID: "lb-1", ListenerID: "lbl-1"}}
+
+		certificates := env.ssl.Certificates()
+		env.kube.ClearActions()
+
+		err := RunLoop(context.Background(), env.config, "", item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if writes := env.writes(); len(writes) > 0 {
+			t.Errorf("dry run changed the cluster: %v", writes)
+		}
+
+		if !reflect.DeepEqual(env.ssl.Certificates(), certificates) || len(env.ssl.DeployRecords()) > 0 {
+			t.Error("dry run changed certificates in tencent cloud")
+		}
+
+		if listener, _ := env.clb.Listener("lb-1", "lbl-1"); listener.CertID != oldCertID {
+			t.Errorf("dry run bound %s to the listener", listener.CertID)
+		}
+
+		got := targetStatus(t, "default/tendo/outdated")
+		if got.Result != status.ResultDryRun {
+			t.Fatalf("got %s, want %s", got.Result, status.ResultDryRun)
+		}
+
+		for _, prefix := range []string{
+			"create opaque secret tendo/outdated-opaque",
+			"update certificate " + oldCertID + " in place",
+			"bind the certificate to clb listeners lb-1/lbl-1",
+		} {
+			if !containsPrefix(got.Planned, prefix) {
+				t.Errorf("planned %v, want %q", got.Planned, prefix)
+			}
+		}
+	})
+
+	t.Run("missing certificate is only planned", func(t *testing.T) {
+		env := newTestEnvironment(t)
+
+		certPEM, keyPEM := testCertificate(t, "missing.example.com")
+		env.addSecret(t, "missing", map[string]string{"tls.crt": certPEM, "tls.key": keyPEM})
+
+		item := env.target("missing")
+		item.DryRun = true
+		env.kube.ClearActions()
+
+		err := RunLoop(context.Background(), env.config, "", item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if writes := env.writes(); len(writes) > 0 {
+			t.Errorf("dry run changed the cluster: %v", writes)
+		}
+
+		if len(env.ssl.Certificates()) > 0 {
+			t.Error("dry run uploaded the certificate")
+		}
+
+		got := targetStatus(t, "default/tendo/missing")
+		if got.CertificateID != newCertificate || !containsPrefix(got.Planned, "upload certificate missing") {
+			t.Errorf("got %s planning %v, want an upload", got.CertificateID, got.Planned)
+		}
+	})
+
+	t.Run("superseded versions are planned on every dry run", func(t *testing.T) {
+		env := newTestEnvironment(t)
+
+		certPEM, keyPEM := testCertificate(t, "versions.example.com")
+		env.addSecret(t, "versions", map[string]string{"tls.crt": certPEM, "tls.key": keyPEM})
+
+		certID := env.ssl.AddCertificate(fake.Certificate{
+			Alias:      "versions",
+			PublicKey:  certPEM,
+			PrivateKey: keyPEM,
+			Status:     fake.CertificateStatusIssued,
+			Tags:       tencent.ProvenanceTags(DefaultClusterName, "tendo", "versions"),
+		})
+
+		var versionIDs []string
+		for _, age := range []time.Duration{48 * time.Hour, 72 * time.Hour} {
+			versionPEM, versionKey := testCertificate(t, "versions.example.com")
+			versionIDs = append(versionIDs, env.ssl.AddCertificate(fake.Certificate{
+				Alias:      "versions-v" + time.Now().Add(-age).UTC().Format("20060102150405"),
+				PublicKey:  versionPEM,
+				PrivateKey: versionKey,
+				Status:     fake.CertificateStatusIssued,
+			}))
+		}
+
+		_, err := env.kube.CoreV1().Secrets("tendo").Create(context.TODO(), &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "versions-opaque", Namespace: "tendo"},
+			Type:       apiv1.SecretTypeOpaque,
+			Data:       map[string][]byte{OpaqueCertID: []byte(certID)},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		item := env.target("versions")
+		item.Retention = config.RetentionConfig{Keep: 1, GracePeriod: time.Hour}
+		item.DryRun = true
+
+		for i := 0; i < 2; i++ {
+			err := RunLoop(context.Background(), env.config, "", item)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := targetStatus(t, "default/tendo/versions")
+			want := []string{"prune certificate " + versionIDs[1]}
+			if got.Result != status.ResultDryRun || len(got.Planned) != 1 || !containsPrefix(got.Planned, want[0]) {
+				t.Fatalf("dry run %d planned %v, want %v", i+1, got.Planned, want)
+			}
+		}
+
+		if _, ok := env.ssl.Certificate(versionIDs[1]); !ok {
+			t.Fatal("dry run pruned the superseded version")
+		}
+
+		item.DryRun = false
+
+		err = RunLoop(context.Background(), env.config, "", item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := env.ssl.Certificate(versionIDs[1]); ok {
+			t.Error("run did not prune the superseded version")
+		}
+
+		if _, ok := env.ssl.Certificate(versionIDs[0]); !ok {
+			t.Error("run pruned the retained version")
+		}
+
+		if got := targetStatus(t, "default/tendo/versions"); got.Result != status.ResultUpToDate {
+			t.Errorf("got %s, want %s", got.Result, status.ResultUpToDate)
+		}
+	})
+}
+
+func TestRunLoopRotatedCACertificate(t *testing.T) {
+	env := newTestEnvironment(t)
+
+	certPEM, keyPEM := testCertificate(t, "mutual.example.com")
+	oldCAPEM, _ := testCertificate(t, "old-ca.example.com")
+	newCAPEM, _ := testCertificate(t, "new-ca.example.com")
+	env.addSecret(t, "mutual", map[string]string{"tls.crt": certPEM, "tls.key": keyPEM, "ca.crt": newCAPEM})
+
+	tags := tencent.ProvenanceTags(DefaultClusterName, "tendo", "mutual")
+	certID := env.ssl.AddCertificate(fake.Certificate{Alias: "mutual", PublicKey: certPEM, PrivateKey: keyPEM, Status: fake.CertificateStatusIssued, Tags: tags})
+	oldCAID := env.ssl.AddCertificate(fake.Certificate{Alias: "mutual-ca", CertificateType: "CA", PublicKey: oldCAPEM, Status: fake.CertificateStatusIssued, Tags: tags})
+	env.clb.AddListener(fake.Listener{LoadBalancerID: "lb-1", ListenerID: "lbl-1", SSLMode: "MUTUAL", CertID: certID, CertCaID: oldCAID})
+
+	item := env.target("mutual")
+	item.UploadCACertificate = true
+	item.CLBListeners = []config.CLBListener{{Region: "ap-singapore", LoadBalancerID: "lb-1", ListenerID: "lbl-1"}}
+
+	item.DryRun = true
+
+	err := RunLoop(context.Background(), env.config, "", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := targetStatus(t, "default/tendo/mutual")
+	for _, prefix := range []string{"upload ca certificate mutual-ca", "bind the certificate to clb listeners lb-1/lbl-1"} {
+		if !containsPrefix(got.Planned, prefix) {
+			t.Errorf("planned %v, want %q", got.Planned, prefix)
+		}
+	}
+
+	if listener, _ := env.clb.Listener("lb-1", "lbl-1"); listener.CertCaID != oldCAID {
+		t.Fatalf("dry run bound ca certificate %s to the listener", listener.CertCaID)
+	}
+
+	item.DryRun = false
+
+	err = RunLoop(context.Background(), env.config, "", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := targetStatus(t, "default/tendo/mutual"); got.Result != status.ResultUpdated {
+		t.Fatalf("got %s with %s, want %s", got.Result, got.Message, status.ResultUpdated)
+	}
+
+	opaque := env.secretData(t, "mutual-opaque")
+
+	newCAID := opaque[OpaqueCACertID]
+	if newCAID == "" || newCAID == oldCAID {
+		t.Fatalf("opaque secret holds ca certificate %q, want the uploaded one", newCAID)
+	}
+
+	listener, _ := env.clb.Listener("lb-1", "lbl-1")
+	if listener.SSLMode != "MUTUAL" || listener.CertID != certID || listener.CertCaID != newCAID {
+		t.Errorf("listener holds %s with ca %s in %s mode, want %s with ca %s in MUTUAL mode", listener.CertID, listener.CertCaID, listener.SSLMode, certID, newCAID)
+	}
+}
@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+)
+
+// RunPullLoop is the reverse of RunLoop, it writes the tencent cloud
+// certificate of a pull target into its kubernetes.io/tls secret and keeps
+// the secret up to date when the certificate is renewed.
+func RunPullLoop(ctx context.Context, c *config.Config, kubeconfig string, item config.WatchConfig) error {
+	cluster, err := ResolveCluster(c, kubeconfig, item.Cluster)
+	if err != nil {
+		return err
+	}
+
+	tencentCreds, err := ResolveCredentials(c, kubeconfig, item.Account)
+	if err != nil {
+		return err
+	}
+
+	tencentSSLCertificate := tencent.TencentSSLCertificate{
+		Context:           ctx,
+		Account:           item.Account,
+		Target:            targetName(cluster, item),
+		Credentials:       tencentCreds,
+		Region:            item.CertificateRegion,
+		ClientOptions:     clientOptions(c.Tencent),
+		CertificateName:   item.CertificateName,
+		CertificateDomain: item.CertificateDomain,
+		MatchBy:           item.CertificateMatchBy,
+	}
+
+	client, err := tencentSSLCertificate.BuildClient()
+	if err != nil {
+		return err
+	}
+
+	plan := newRunPlan(cluster, item, "")
+
+	err = planPull(plan, cluster, item, &tencentSSLCertificate, client)
+	if err != nil {
+		reportStatus(cluster, item, plan.certID, status.ResultFailed, err)
+		return err
+	}
+
+	if c.DryRun || item.DryRun {
+		plan.report(cluster)
+		return nil
+	}
+
+	err = plan.execute()
+	if err != nil {
+		reportStatus(cluster, item, plan.certID, status.ResultFailed, err)
+		return err
+	}
+
+	if plan.result != status.ResultUpdated {
+		logger.Logger.Info(fmt.Sprintf("secret %s is up to date with certificate %s stored in tencent cloud", item.SecretName, plan.certID))
+		reportStatus(cluster, item, plan.certID, status.ResultUpToDate, nil)
+		return nil
+	}
+
+	logger.Logger.Info(fmt.Sprintf("wrote certificate %s stored in tencent cloud into secret %s", plan.certID, item.SecretName))
+	reportStatus(cluster, item, plan.certID, status.ResultUpdated, nil)
+
+	return nil
+}
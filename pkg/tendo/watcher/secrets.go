@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
 	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -13,22 +17,134 @@ import (
 )
 
 type SecretData struct {
-	PublicKey string
-	PrivateKey string
+	PublicKey          string
+	PrivateKey         string
+	CACertificate      string
+	EncryptCertificate string
+	EncryptPrivateKey  string
 }
 
-func GetSecret(kubeconfig string, secretNamespace string, secretName string) (SecretData, error) {
+// SecretKeys names the keys of the secret data read by GetSecret.
+type SecretKeys struct {
+	Certificate        string
+	PrivateKey         string
+	CACertificate      string
+	EncryptCertificate string
+	EncryptPrivateKey  string
+}
+
+// DefaultSecretKeys are the keys of a kubernetes.io/tls secret.
+var DefaultSecretKeys = SecretKeys{
+	Certificate:   "tls.crt",
+	PrivateKey:    "tls.key",
+	CACertificate: "ca.crt",
+}
+
+// secretKeys returns the secret keys of a watch target, SM2 targets read
+// their signing and encryption key pairs from the configured keys.
+func secretKeys(item config.WatchConfig) SecretKeys {
+	keys := DefaultSecretKeys
+
+	if item.SM2 != nil {
+		keys.Certificate = item.SM2.SignCertificateKey
+		keys.PrivateKey = item.SM2.SignPrivateKeyKey
+		keys.EncryptCertificate = item.SM2.EncryptCertificateKey
+		keys.EncryptPrivateKey = item.SM2.EncryptPrivateKeyKey
+	}
+
+	return keys
+}
+
+// Fingerprint fingerprints the leaf certificate in the secret and checks
+// that the secret private key belongs to it.
+func (s SecretData) Fingerprint() (tencent.CertificateFingerprint, error) {
+	return fingerprintKeyPair(s.PublicKey, s.PrivateKey, "")
+}
+
+// EncryptFingerprint does the same as Fingerprint for the encryption key
+// pair of an SM2 certificate.
+func (s SecretData) EncryptFingerprint() (tencent.CertificateFingerprint, error) {
+	if s.EncryptCertificate == "" || s.EncryptPrivateKey == "" {
+		err := fmt.Errorf("encryption certificate or key is missing in secret")
+		return tencent.CertificateFingerprint{}, err
+	}
+
+	return fingerprintKeyPair(s.EncryptCertificate, s.EncryptPrivateKey, "encryption ")
+}
+
+// CheckSM2 rejects an SM2 certificate on a target without sm2, whose
+// encryption key pair would not be uploaded, and any other certificate on
+// an sm2 target.
+func (s SecretData) CheckSM2(item config.WatchConfig) error {
+	publicKey, err := base64.StdEncoding.DecodeString(s.PublicKey)
+	if err != nil {
+		err := fmt.Errorf("unable to decode certificate in secret")
+		return err
+	}
+
+	isSM2 := tencent.IsSM2Certificate(publicKey)
+
+	if item.SM2 != nil && !isSM2 {
+		err := fmt.Errorf("certificate in secret %s is not an sm2 certificate, remove sm2 from the watch target", item.SecretName)
+		return err
+	}
+
+	if item.SM2 == nil && isSM2 {
+		err := fmt.Errorf("certificate in secret %s is an sm2 certificate, add sm2 to the watch target", item.SecretName)
+		return err
+	}
+
+	return nil
+}
+
+func fingerprintKeyPair(certificate string, key string, kind string) (tencent.CertificateFingerprint, error) {
+	var fingerprint tencent.CertificateFingerprint
+
+	publicKey, err := base64.StdEncoding.DecodeString(certificate)
+	if err != nil {
+		err := fmt.Errorf("unable to decode %scertificate in secret", kind)
+		return fingerprint, err
+	}
+
+	privateKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		err := fmt.Errorf("unable to decode %sprivate key in secret", kind)
+		return fingerprint, err
+	}
+
+	fingerprint, err = tencent.ParseCertificateFingerprint(publicKey)
+	if err != nil {
+		return fingerprint, err
+	}
+
+	matched, err := tencent.PrivateKeyMatches(fingerprint, privateKey)
+	if err != nil {
+		return fingerprint, err
+	}
+
+	if !matched {
+		err := fmt.Errorf("%sprivate key in secret does not match its certificate", kind)
+		return fingerprint, err
+	}
+
+	return fingerprint, nil
+}
+
+func GetSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string, keys SecretKeys) (SecretData, error) {
 	var secretData SecretData
 
-	client := k8s.GetKubernetesConfig(kubeconfig)
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return secretData, err
+	}
 
 	secret, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
 
 	if errors.IsNotFound(err) {
-		err := fmt.Errorf("secret %s not found in namespace %s", secretName, secretNamespace)
+		err := fmt.Errorf("secret %s not found in namespace %s of cluster %s", secretName, secretNamespace, cluster.Name)
 		return secretData, err
 
-	} else if statusError, isStatus := err.(*errors.StatusError); isStatus { 
+	} else if statusError, isStatus := err.(*errors.StatusError); isStatus {
 		err := fmt.Errorf("error getting secret %s", statusError.ErrStatus.Message)
 		return secretData, err
 
@@ -37,47 +153,91 @@ func GetSecret(kubeconfig string, secretNamespace string, secretName string) (Se
 		return secretData, err
 
 	} else {
-		var publicKey string
-		var privateKey string
-
 		for key, value := range secret.Data {
-			if key == "tls.crt" {
-				encodedValue := base64.StdEncoding.EncodeToString([]byte(value))
-				publicKey = encodedValue
-			} else if key == "tls.key" {
-				encodedValue := base64.StdEncoding.EncodeToString([]byte(value))
-				privateKey = encodedValue
-			} else {
-				logger.Logger.Error("unsupported secret data")
+			encodedValue := base64.StdEncoding.EncodeToString([]byte(value))
+
+			switch key {
+			case keys.Certificate:
+				secretData.PublicKey = encodedValue
+			case keys.PrivateKey:
+				secretData.PrivateKey = encodedValue
+			case keys.CACertificate:
+				secretData.CACertificate = encodedValue
+			case keys.EncryptCertificate:
+				secretData.EncryptCertificate = encodedValue
+			case keys.EncryptPrivateKey:
+				secretData.EncryptPrivateKey = encodedValue
+			default:
+				// e.g. the encryption key pair of an sm2 secret watched by a
+				// non-sm2 target, which the certificate check rejects
+				logger.Logger.Debug(fmt.Sprintf("ignoring secret data %s of secret %s", key, secretName))
 			}
 		}
 
-		secretData.PublicKey = publicKey
-		secretData.PrivateKey = privateKey
-
 		return secretData, nil
 	}
 }
 
-func CreateOpaqueSecret(kubeconfig string, secretNamespace string, secretName string, data string) error {
-	client := k8s.GetKubernetesConfig(kubeconfig)
+// Keys of the opaque secret holding the Tencent Cloud certificate IDs.
+// OpaqueDeployedInstances lists the certificate instances, as
+// "<resourceType>/<instanceId>", the certificate of OpaqueCertID has been
+// deployed to.
+const (
+	OpaqueCertID            = "qcloud_cert_id"
+	OpaqueCACertID          = "qcloud_ca_cert_id"
+	OpaqueDeployedInstances = "qcloud_deployed_instances"
+)
+
+// GetOpaqueSecret returns the data of the opaque secret, which is empty
+// when the secret does not exist yet.
+func GetOpaqueSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string) (map[string]string, error) {
+	data := map[string]string{}
 
-	_, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return data, err
+	}
+
+	secret, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		return data, nil
+
+	} else if err != nil {
+		err := fmt.Errorf("unable to get opaque secret %s with error: %s", secretName, err)
+		return data, err
+	}
+
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+
+	return data, nil
+}
+
+// SyncOpaqueSecret creates the opaque secret with data, or updates the keys
+// of data which differ in an existing one.
+func SyncOpaqueSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string, data map[string]string) error {
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	secretClient := client.CoreV1().Secrets(secretNamespace)
+
+	secret, err := secretClient.Get(context.TODO(), secretName, metav1.GetOptions{})
 
 	if errors.IsNotFound(err) {
 		// create the secret
-		logger.Logger.Info(fmt.Sprintf("secret %s not found, creating a new one", secretName))
+		logger.Logger.Info(fmt.Sprintf("secret %s not found in cluster %s, creating a new one", secretName, cluster.Name))
 
-		secretClient := client.CoreV1().Secrets(secretNamespace)
 		secret := &apiv1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: secretName,
+				Name:      secretName,
 				Namespace: secretNamespace,
 			},
-			Type: "Opaque",
-			StringData: map[string]string {
-				"qcloud_cert_id": data,
-			},
+			Type:       "Opaque",
+			StringData: data,
 		}
 
 		_, err := secretClient.Create(context.TODO(), secret, metav1.CreateOptions{})
@@ -85,7 +245,185 @@ func CreateOpaqueSecret(kubeconfig string, secretNamespace string, secretName st
 			err := fmt.Errorf("unable to create opaque secret %s with error: %s", secretName, err)
 			return err
 		}
+
+		return nil
+
+	} else if err != nil {
+		err := fmt.Errorf("unable to get opaque secret %s with error: %s", secretName, err)
+		return err
+	}
+
+	if len(changedKeys(secret, data)) == 0 {
+		return nil
+	}
+
+	logger.Logger.Info(fmt.Sprintf("updating opaque secret %s in cluster %s", secretName, cluster.Name))
+
+	secret.StringData = data
+
+	_, err = secretClient.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		err := fmt.Errorf("unable to update opaque secret %s with error: %s", secretName, err)
+		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// PlanOpaqueSecret describes what SyncOpaqueSecret would change in the
+// opaque secret, it is empty when the secret is up to date.
+func PlanOpaqueSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string, data map[string]string) (string, error) {
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("create opaque secret %s/%s in cluster %s", secretNamespace, secretName, cluster.Name), nil
+
+	} else if err != nil {
+		err := fmt.Errorf("unable to get opaque secret %s with error: %s", secretName, err)
+		return "", err
+	}
+
+	keys := changedKeys(secret, data)
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf("update %s of opaque secret %s/%s in cluster %s", strings.Join(keys, ", "), secretNamespace, secretName, cluster.Name), nil
+}
+
+// changedKeys returns the keys of data whose value differs in the secret.
+func changedKeys(secret *apiv1.Secret, data map[string]string) []string {
+	var keys []string
+	for key, value := range data {
+		if string(secret.Data[key]) != value {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CertificateIDAnnotation records the tencent cloud certificate a pulled
+// kubernetes.io/tls secret was written from.
+const CertificateIDAnnotation = "tendo/certificate-id"
+
+// SyncTLSSecret creates the kubernetes.io/tls secret with the certificate and
+// key, or updates an existing one written by tendo holding other data. It
+// reports whether the secret was written.
+func SyncTLSSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string, certID string, certificate string, privateKey string) (bool, error) {
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return false, err
+	}
+
+	secretClient := client.CoreV1().Secrets(secretNamespace)
+
+	secret, err := secretClient.Get(context.TODO(), secretName, metav1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		logger.Logger.Info(fmt.Sprintf("secret %s not found in cluster %s, creating a new one", secretName, cluster.Name))
+
+		secret := &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: secretNamespace,
+				Annotations: map[string]string{
+					CertificateIDAnnotation: certID,
+				},
+			},
+			Type: apiv1.SecretTypeTLS,
+			Data: map[string][]byte{
+				apiv1.TLSCertKey:       []byte(certificate),
+				apiv1.TLSPrivateKeyKey: []byte(privateKey),
+			},
+		}
+
+		_, err := secretClient.Create(context.TODO(), secret, metav1.CreateOptions{})
+		if err != nil {
+			err := fmt.Errorf("unable to create tls secret %s with error: %s", secretName, err)
+			return false, err
+		}
+
+		return true, nil
+
+	} else if err != nil {
+		err := fmt.Errorf("unable to get tls secret %s with error: %s", secretName, err)
+		return false, err
+	}
+
+	current, err := tlsSecretCurrent(secret, certID, certificate, privateKey)
+	if err != nil || current {
+		return false, err
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[CertificateIDAnnotation] = certID
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[apiv1.TLSCertKey] = []byte(certificate)
+	secret.Data[apiv1.TLSPrivateKeyKey] = []byte(privateKey)
+
+	_, err = secretClient.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		err := fmt.Errorf("unable to update tls secret %s with error: %s", secretName, err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PlanTLSSecret describes what SyncTLSSecret would change in the
+// kubernetes.io/tls secret, it is empty when the secret is up to date.
+func PlanTLSSecret(cluster k8s.ClusterConfig, secretNamespace string, secretName string, certID string, certificate string, privateKey string) (string, error) {
+	client, err := k8s.GetClusterClient(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("create tls secret %s/%s in cluster %s from certificate %s", secretNamespace, secretName, cluster.Name, certID), nil
+
+	} else if err != nil {
+		err := fmt.Errorf("unable to get tls secret %s with error: %s", secretName, err)
+		return "", err
+	}
+
+	current, err := tlsSecretCurrent(secret, certID, certificate, privateKey)
+	if err != nil || current {
+		return "", err
+	}
+
+	return fmt.Sprintf("update tls secret %s/%s in cluster %s from certificate %s", secretNamespace, secretName, cluster.Name, certID), nil
+}
+
+// tlsSecretCurrent reports whether the secret holds the certificate already.
+// The type of a secret cannot be changed, so any other type is an error, and
+// secrets without the certificate id annotation were not written by tendo
+// and are left alone.
+func tlsSecretCurrent(secret *apiv1.Secret, certID string, certificate string, privateKey string) (bool, error) {
+	if secret.Type != apiv1.SecretTypeTLS {
+		err := fmt.Errorf("secret %s has type %s instead of %s", secret.Name, secret.Type, apiv1.SecretTypeTLS)
+		return false, err
+	}
+
+	if _, ok := secret.Annotations[CertificateIDAnnotation]; !ok {
+		err := fmt.Errorf("secret %s was not written by tendo, delete it or annotate it with %s to let tendo manage it", secret.Name, CertificateIDAnnotation)
+		return false, err
+	}
+
+	current := string(secret.Data[apiv1.TLSCertKey]) == certificate && string(secret.Data[apiv1.TLSPrivateKeyKey]) == privateKey && secret.Annotations[CertificateIDAnnotation] == certID
+
+	return current, nil
+}
@@ -3,24 +3,50 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fredytarigan/Tendo/pkg/tencent"
 	"github.com/fredytarigan/Tendo/pkg/tendo/config"
 	"github.com/fredytarigan/Tendo/pkg/tendo/logger"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
 )
 
 func Start(ctx context.Context, c *config.Config, kubeconfig string) error {
+	configureRateLimits(c.Tencent.RateLimit)
+
+	if c.Inventory.Enabled {
+		go StartInventory(ctx, c, kubeconfig)
+	}
+
 	tick := time.NewTicker(c.WatchInterval * time.Second)
 	defer tick.Stop()
 
+	// a target still deploying from an earlier tick is skipped, so two runs
+	// never upload or deploy the same certificate at once
+	running := make([]atomic.Bool, len(c.WatchTargets))
+
 	for {
 
-		for _, item := range c.WatchTargets {
+		for i, item := range c.WatchTargets {
+			if !running[i].CompareAndSwap(false, true) {
+				logger.Logger.Info(fmt.Sprintf("skipping %s/%s, its previous run has not finished yet", item.SecretNamespace, item.SecretName))
+				continue
+			}
+
 			go func() {
+				defer running[i].Store(false)
+
 				err := RunLoop(ctx, c, kubeconfig, item)
 				if err != nil {
 					logger.Logger.Error(fmt.Sprintf("%s", err))
+
+					// rebuild rejected credentials on the next tick instead
+					// of waiting for their refresh
+					if tencent.IsAuthFailure(err) {
+						InvalidateCredentials(item.Account)
+					}
 				}
 			}()
 		}
@@ -35,13 +61,44 @@ func Start(ctx context.Context, c *config.Config, kubeconfig string) error {
 }
 
 func RunLoop(ctx context.Context, c *config.Config, kubeconfig string, item config.WatchConfig) error {
-	secret, err := GetSecret(kubeconfig, item.SecretNamespace, item.SecretName)
+	if item.Mode == config.ModePull {
+		return RunPullLoop(ctx, c, kubeconfig, item)
+	}
 
+	cluster, err := ResolveCluster(c, kubeconfig, item.Cluster)
 	if err != nil {
 		return err
 	}
 
-	tencentCreds, err := tencent.BuildCredentials()
+	secret, err := GetSecret(cluster, item.SecretNamespace, item.SecretName, secretKeys(item))
+
+	if err != nil {
+		return err
+	}
+
+	// validate the secret before anything is uploaded from it
+	secretFingerprint, err := secret.Fingerprint()
+	if err != nil {
+		err := fmt.Errorf("invalid certificate in secret %s with error: %s", item.SecretName, err)
+		return err
+	}
+
+	err = secret.CheckSM2(item)
+	if err != nil {
+		return err
+	}
+
+	// sm2 certificates come with a second key pair used for encryption
+	var encryptFingerprint tencent.CertificateFingerprint
+	if item.SM2 != nil {
+		encryptFingerprint, err = secret.EncryptFingerprint()
+		if err != nil {
+			err := fmt.Errorf("invalid sm2 certificate in secret %s with error: %s", item.SecretName, err)
+			return err
+		}
+	}
+
+	tencentCreds, err := ResolveCredentials(c, kubeconfig, item.Account)
 
 	if err != nil {
 		return err
@@ -49,23 +106,55 @@ func RunLoop(ctx context.Context, c *config.Config, kubeconfig string, item conf
 
 	var certificateRequestTypes []tencent.CertificateResourceType
 	for _, value := range item.CertificateResourceTypes {
-		result := tencent.CertificateResourceType {
-			Name: value.Name,
+		result := tencent.CertificateResourceType{
+			Name:    string(value.Name),
 			Regions: value.Regions,
 		}
 		certificateRequestTypes = append(certificateRequestTypes, result)
 	}
 
+	var certificateInstances []tencent.CertificateInstance
+	for _, value := range item.CertificateInstances {
+		certificateInstances = append(certificateInstances, tencent.CertificateInstance{
+			ResourceType: string(value.ResourceType),
+			InstanceIDs:  value.InstanceIDs,
+		})
+	}
+
+	var clbListeners []tencent.CLBListener
+	for _, value := range item.CLBListeners {
+		clbListeners = append(clbListeners, tencent.CLBListener{
+			Region:         value.Region,
+			LoadBalancerID: value.LoadBalancerID,
+			ListenerID:     value.ListenerID,
+			Domain:         value.Domain,
+		})
+	}
 
-	tencentSSLCertificate := tencent.TencentSSLCertificate {
-		Context: ctx,
-		Credentials: tencentCreds,
-		Region: item.CertificateRegion,
-		CertificateID: item.CertificateID,
-		CertificateName: item.CertificateName,
+	tencentSSLCertificate := tencent.TencentSSLCertificate{
+		Context:                  ctx,
+		Account:                  item.Account,
+		Target:                   targetName(cluster, item),
+		Credentials:              tencentCreds,
+		Region:                   item.CertificateRegion,
+		ClientOptions:            clientOptions(c.Tencent),
+		CertificateID:            item.CertificateID,
+		CertificateName:          item.CertificateName,
+		CertificateDomain:        item.CertificateDomain,
+		MatchBy:                  item.CertificateMatchBy,
 		CertificateResourceTypes: certificateRequestTypes,
-		PublicKey: secret.PublicKey,
-		PrivateKey: secret.PrivateKey,
+		CertificateInstances:     certificateInstances,
+		CLBListeners:             clbListeners,
+		PublicKey:                secret.PublicKey,
+		PrivateKey:               secret.PrivateKey,
+		CACertificate:            secret.CACertificate,
+		EncryptCertificate:       secret.EncryptCertificate,
+		EncryptPrivateKey:        secret.EncryptPrivateKey,
+		Tags:                     tencent.ProvenanceTags(cluster.Name, item.SecretNamespace, item.SecretName),
+		Retention: tencent.RetentionPolicy{
+			Keep:        item.Retention.Keep,
+			GracePeriod: item.Retention.GracePeriod,
+		},
 	}
 
 	client, err := tencentSSLCertificate.BuildClient()
@@ -73,47 +162,78 @@ func RunLoop(ctx context.Context, c *config.Config, kubeconfig string, item conf
 		return err
 	}
 
-	cert, err := tencentSSLCertificate.GetCertificateData(client)
+	plan := newRunPlan(cluster, item, tencentSSLCertificate.CertificateID)
+
+	err = planPush(plan, cluster, item, &tencentSSLCertificate, client, secret, secretFingerprint, encryptFingerprint)
 	if err != nil {
+		reportStatus(cluster, item, plan.certID, status.ResultFailed, err)
 		return err
 	}
 
-	// create opaque secret if not exists
-	CreateOpaqueSecret(kubeconfig, item.SecretNamespace, item.OpaqueSecretName, tencentSSLCertificate.CertificateID)
+	if c.DryRun || item.DryRun {
+		plan.report(cluster)
+		return nil
+	}
 
-	// compare secret with cert
-	certChanged := false
+	err = plan.execute()
+	if err != nil {
+		reportDeployment(cluster, item, plan.certID, status.ResultFailed, tencentSSLCertificate.Deployment, err)
+		return err
+	}
 
-	if secret.PublicKey != cert.CertificatePublicKey || secret.PrivateKey != cert.CertificatePrivateKey {
-		certChanged = true
+	if plan.prunes {
+		markPruned(plan.target)
 	}
 
-	if !certChanged {
-		logger.Logger.Info(fmt.Sprintf("certificate in secret %s is up to date with certificate stored in tencent cloud", item.SecretName))
-		logger.Logger.Info("not doing anything for now")
+	reportDeployment(cluster, item, plan.certID, plan.result, tencentSSLCertificate.Deployment, nil)
 
-		return nil
-	}
+	return nil
+}
 
-	// if secret is not matched
-	// we update certificates in tencent cloud
-	logger.Logger.Info(fmt.Sprintf("certificate in secret %s is not matched with certificated stored in tencent cloud with name %s", item.SecretName, item.CertificateName))
-	logger.Logger.Info(fmt.Sprintf("updating certificate in tencent cloud for certificate with name %s", item.CertificateName))
+func clientOptions(c config.TencentConfig) tencent.ClientOptions {
+	return tencent.ClientOptions{
+		Endpoint:       c.Endpoint,
+		CLBEndpoint:    c.CLBEndpoint,
+		RootDomain:     c.RootDomain,
+		Proxy:          c.Proxy,
+		CABundle:       c.CABundle,
+		RequestTimeout: c.RequestTimeout,
+	}
+}
 
-	err = tencentSSLCertificate.UpdateCertificateDetail(client)
-	if err != nil {
-		return err
+func configureRateLimits(c config.RateLimitConfig) {
+	actions := map[string]tencent.RateLimit{}
+	for action, value := range c.Actions {
+		actions[action] = tencent.RateLimit{
+			QPS:   value.QPS,
+			Burst: value.Burst,
+		}
 	}
 
-	// wait for 5 seconds, for deployment started
-	time.Sleep(5 * time.Second)
+	tencent.ConfigureRateLimits(tencent.RateLimit{QPS: c.QPS, Burst: c.Burst}, actions)
+}
 
-	_, err = tencentSSLCertificate.WatchCertificateUpdateStatus(client)
-	if err != nil {
-		return err
-	}
+const pruneInterval = time.Hour
 
-	// fmt.Printf("Watch certificate update result: %s", newCertID)
+var (
+	pruneMu    sync.Mutex
+	lastPruned = map[string]time.Time{}
+)
 
-	return nil
-}
\ No newline at end of file
+// pruneDue limits pruning of superseded certificates to once per
+// pruneInterval for each target.
+func pruneDue(target string) bool {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+
+	return time.Since(lastPruned[target]) >= pruneInterval
+}
+
+// markPruned starts the next pruneInterval of a target. Dry runs do not
+// mark targets, so they list the same versions as the next run prunes.
+func markPruned(target string) {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+
+	lastPruned[target] = time.Now()
+}
@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fredytarigan/Tendo/pkg/k8s"
+	"github.com/fredytarigan/Tendo/pkg/tencent"
+	"github.com/fredytarigan/Tendo/pkg/tendo/config"
+	"github.com/fredytarigan/Tendo/pkg/tendo/status"
+)
+
+// targetName identifies a watch target as cluster/namespace/secret, the same
+// secret name may be watched in several clusters.
+func targetName(cluster k8s.ClusterConfig, item config.WatchConfig) string {
+	return fmt.Sprintf("%s/%s/%s", cluster.Name, item.SecretNamespace, item.SecretName)
+}
+
+// reportStatus publishes the outcome of a RunLoop on the status API.
+func reportStatus(cluster k8s.ClusterConfig, item config.WatchConfig, certificateID string, result string, err error) {
+	status.SetTarget(newTargetStatus(cluster, item, certificateID, result, err))
+}
+
+// reportDeployment publishes the outcome of a certificate update like
+// reportStatus, with the deploy records of the update whether it succeeded,
+// partially succeeded or did not finish.
+func reportDeployment(cluster k8s.ClusterConfig, item config.WatchConfig, certificateID string, result string, summary tencent.DeploymentSummary, err error) {
+	targetStatus := newTargetStatus(cluster, item, certificateID, result, err)
+	if len(targetStatus.Deployments) == 0 {
+		targetStatus.Deployments = deployments(summary)
+	}
+
+	status.SetTarget(targetStatus)
+}
+
+func newTargetStatus(cluster k8s.ClusterConfig, item config.WatchConfig, certificateID string, result string, err error) status.TargetStatus {
+	targetStatus := status.TargetStatus{
+		Target:        targetName(cluster, item),
+		Cluster:       cluster.Name,
+		CertificateID: certificateID,
+		Result:        result,
+	}
+
+	if err != nil {
+		targetStatus.Result = status.ResultFailed
+		targetStatus.Message = err.Error()
+
+		deploymentError := &tencent.DeploymentFailedError{}
+		if errors.As(err, &deploymentError) {
+			targetStatus.Result = status.ResultRolledBack
+
+			for _, rollback := range deploymentError.Rollbacks {
+				if !rollback.Succeeded {
+					targetStatus.Result = status.ResultRollbackFailed
+				}
+
+				targetStatus.Rollbacks = append(targetStatus.Rollbacks, status.Rollback{
+					FailedCertificateID:   rollback.FailedCertificateID,
+					RestoredCertificateID: rollback.RestoredCertificateID,
+					ResourceTypes:         rollback.ResourceTypes,
+					Regions:               rollback.Regions,
+					Succeeded:             rollback.Succeeded,
+					Error:                 rollback.Error,
+				})
+			}
+
+			targetStatus.Deployments = deployments(deploymentError.Summary)
+		}
+	}
+
+	return targetStatus
+}
+
+func deployments(summary tencent.DeploymentSummary) []status.Deployment {
+	var result []status.Deployment
+	for _, group := range summary.Groups {
+		result = append(result, status.Deployment{
+			ResourceType:    group.ResourceType,
+			Region:          group.Region,
+			Status:          group.Status.String(),
+			DeployRecordIDs: group.RecordIDs,
+		})
+	}
+
+	return result
+}